@@ -7,13 +7,16 @@ import (
 	"errors"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v7"
-	"github.com/newrelic/go-agent/v3/integrations/nrredis-v7"
 	"github.com/nickhstr/goweb/config"
 	"github.com/nickhstr/goweb/logger"
+	"github.com/nickhstr/goweb/tracing"
 	"github.com/spf13/viper"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var log = logger.New("redis")
@@ -30,14 +33,55 @@ type Cacher interface {
 	Set(context.Context, string, interface{}, time.Duration) error
 }
 
+// HookFunc returns a hook for a Redis client. Clients of a single server
+// are described by their options; cluster and sentinel clients have nil
+// options.
+type HookFunc func(opts *redis.Options) redis.Hook
+
+var (
+	hooksMu = &sync.Mutex{}
+	hooks   []HookFunc
+)
+
+// RegisterHook adds a hook, made by h, to every Redis client created by New
+// afterwards. Instrumentation packages, such as newrelic, use this to record
+// commands.
+func RegisterHook(h HookFunc) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+
+	hooks = append(hooks, h)
+}
+
+func registeredHooks() []HookFunc {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+
+	return append([]HookFunc(nil), hooks...)
+}
+
 // Client holds a redisCacher instance, and satisfies the cache.Cache interface.
 type Client struct {
 	client redisCacher
 }
 
+// startSpan starts a client span for a Redis command.
+func startSpan(ctx context.Context, command string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(
+		ctx,
+		"redis "+command,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperationKey.String(command),
+		),
+	)
+}
+
 // Del deletes keys.
-func (c *Client) Del(ctx context.Context, keys ...string) error {
-	var err error
+func (c *Client) Del(ctx context.Context, keys ...string) (err error) {
+	ctx, span := startSpan(ctx, "DEL")
+	defer func() { tracing.EndSpan(span, err) }()
 
 	switch cc := c.client.(type) {
 	case *redis.ClusterClient:
@@ -63,6 +107,17 @@ func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
 		err  error
 	)
 
+	ctx, span := startSpan(ctx, "GET")
+	defer func() {
+		// a missing key is an expected outcome, not a failed command
+		if err == redis.Nil {
+			tracing.EndSpan(span, nil)
+			return
+		}
+
+		tracing.EndSpan(span, err)
+	}()
+
 	switch cc := c.client.(type) {
 	case *redis.ClusterClient:
 		data, err = cc.WithContext(ctx).Get(key).Bytes()
@@ -87,8 +142,9 @@ func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
 }
 
 // Set stores data under a key for a set amount of time.
-func (c *Client) Set(ctx context.Context, key string, val interface{}, t time.Duration) error {
-	var err error
+func (c *Client) Set(ctx context.Context, key string, val interface{}, t time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "SET")
+	defer func() { tracing.EndSpan(span, err) }()
 
 	switch cc := c.client.(type) {
 	case *redis.ClusterClient:
@@ -125,6 +181,7 @@ func New() Cacher {
 	}
 
 	addr := net.JoinHostPort(viper.GetString("REDIS_HOST"), viper.GetString("REDIS_PORT"))
+	clientHooks := registeredHooks()
 	maxRetries := 1
 	minRetryBackoff := 8 * time.Millisecond
 	maxRetryBackoff := 512 * time.Millisecond
@@ -147,7 +204,11 @@ func New() Cacher {
 			OnConnect:       onConnect,
 		}
 		rc := redis.NewClusterClient(clusterOptions)
-		rc.AddHook(nrredis.NewHook(nil))
+
+		for _, h := range clientHooks {
+			rc.AddHook(h(nil))
+		}
+
 		c = &Client{rc}
 	case "server":
 		options := &redis.Options{
@@ -158,7 +219,11 @@ func New() Cacher {
 			OnConnect:       onConnect,
 		}
 		rc := redis.NewClient(options)
-		rc.AddHook(nrredis.NewHook(options))
+
+		for _, h := range clientHooks {
+			rc.AddHook(h(options))
+		}
+
 		c = &Client{rc}
 	case "sentinel":
 		if err := config.Validate([]string{
@@ -184,7 +249,11 @@ func New() Cacher {
 			OnConnect:        onConnect,
 		}
 		rc := redis.NewFailoverClient(sentinelOptions)
-		rc.AddHook(nrredis.NewHook(nil))
+
+		for _, h := range clientHooks {
+			rc.AddHook(h(nil))
+		}
+
 		c = &Client{rc}
 	default:
 		// supplied mode is undefined or not a supported mode
@@ -0,0 +1,290 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched, using errors.Is, by errors returned for
+// requests rejected by an open circuit breaker.
+var ErrCircuitOpen = errors.New("client: circuit breaker is open")
+
+// CircuitOpenError is returned when a request is rejected because its host's
+// circuit breaker is open.
+type CircuitOpenError struct {
+	// Host is the upstream host whose circuit is open.
+	Host string
+	// RetryAt is when the breaker will next allow a probe request.
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrCircuitOpen.Error(), e.Host)
+}
+
+// Is reports whether target is ErrCircuitOpen.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerPolicy configures per-host circuit breaking.
+// A host's circuit opens (rejecting requests) when either trip condition is
+// met. After the cooldown, a limited number of probe requests are let through
+// (half-open); if they all succeed the circuit closes, otherwise it opens
+// again.
+// Transport errors and 5xx responses count as failures.
+type BreakerPolicy struct {
+	// ConsecutiveFailures trips the circuit after this many failures in a
+	// row. Zero disables this condition.
+	ConsecutiveFailures int
+
+	// ErrorRate trips the circuit when the ratio of failures to requests
+	// within Window reaches this value (0 to 1). Zero disables this
+	// condition.
+	ErrorRate float64
+
+	// MinRequests is the minimum number of requests within Window before
+	// ErrorRate is considered.
+	// Default is: 20.
+	MinRequests int
+
+	// Window is the period over which the error rate is measured.
+	// Default is: 10 seconds.
+	Window time.Duration
+
+	// Cooldown is how long the circuit stays open before allowing probes.
+	// Default is: 30 seconds.
+	Cooldown time.Duration
+
+	// HalfOpenProbes is the number of probe requests allowed while
+	// half-open, all of which must succeed to close the circuit.
+	// Default is: 1.
+	HalfOpenProbes int
+
+	// ServeStale, when true, serves the last cached response for a GET
+	// request while its host's circuit is open.
+	ServeStale bool
+
+	// StaleTTL is how long responses are kept for ServeStale.
+	// Default is: 24 hours.
+	StaleTTL time.Duration
+}
+
+func (p BreakerPolicy) enabled() bool {
+	return p.ConsecutiveFailures > 0 || p.ErrorRate > 0
+}
+
+// withDefaults returns a copy of the policy with defaults applied.
+func (p BreakerPolicy) withDefaults() BreakerPolicy {
+	if p.MinRequests == 0 {
+		p.MinRequests = 20
+	}
+
+	if p.Window == 0 {
+		p.Window = 10 * time.Second
+	}
+
+	if p.Cooldown == 0 {
+		p.Cooldown = 30 * time.Second
+	}
+
+	if p.HalfOpenProbes == 0 {
+		p.HalfOpenProbes = 1
+	}
+
+	if p.StaleTTL == 0 {
+		p.StaleTTL = 24 * time.Hour
+	}
+
+	return p
+}
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// outcome is the result of a request, as far as a breaker is concerned.
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored is used for requests which say nothing about the
+	// upstream's health, such as those canceled by the caller.
+	outcomeIgnored
+)
+
+// breaker is a single host's circuit breaker.
+type breaker struct {
+	mu     sync.Mutex
+	policy BreakerPolicy
+	state  breakerState
+
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	openedAt time.Time
+	// trial numbers the breaker's half-open periods, so that probes are
+	// told apart from requests allowed before, or in earlier periods
+	trial          int
+	probesInFlight int
+	probeSuccesses int
+}
+
+// allow reports whether a request may be sent, returning a
+// CircuitOpenError if not. Requests allowed while the breaker is half-open
+// are probes, for which the half-open period's trial number is returned, to
+// pass to record; zero is returned for other requests.
+func (b *breaker) allow(host string, now time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == stateOpen {
+		if now.Sub(b.openedAt) < b.policy.Cooldown {
+			return 0, &CircuitOpenError{host, b.openedAt.Add(b.policy.Cooldown)}
+		}
+
+		b.state = stateHalfOpen
+		b.trial++
+		b.probesInFlight = 0
+		b.probeSuccesses = 0
+	}
+
+	if b.state == stateHalfOpen {
+		if b.probesInFlight >= b.policy.HalfOpenProbes {
+			return 0, &CircuitOpenError{host, now}
+		}
+
+		b.probesInFlight++
+
+		return b.trial, nil
+	}
+
+	return 0, nil
+}
+
+// record updates the breaker with the outcome of an allowed request, given
+// the trial number allow returned for it.
+func (b *breaker) record(trial int, o outcome, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == stateHalfOpen {
+		// only the period's probes decide whether the circuit closes
+		if trial != b.trial {
+			return
+		}
+
+		b.probesInFlight--
+
+		switch o {
+		case outcomeFailure:
+			b.open(now)
+		case outcomeSuccess:
+			b.probeSuccesses++
+			if b.probeSuccesses >= b.policy.HalfOpenProbes {
+				b.close(now)
+			}
+		}
+
+		return
+	}
+
+	if b.state != stateClosed || o == outcomeIgnored {
+		return
+	}
+
+	if now.Sub(b.windowStart) >= b.policy.Window {
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+
+	b.requests++
+
+	if o == outcomeSuccess {
+		b.consecutive = 0
+		return
+	}
+
+	b.failures++
+	b.consecutive++
+
+	p := b.policy
+	tripConsecutive := p.ConsecutiveFailures > 0 && b.consecutive >= p.ConsecutiveFailures
+	tripRate := p.ErrorRate > 0 &&
+		b.requests >= p.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= p.ErrorRate
+
+	if tripConsecutive || tripRate {
+		b.open(now)
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = stateOpen
+	b.openedAt = now
+}
+
+func (b *breaker) close(now time.Time) {
+	b.state = stateClosed
+	b.consecutive = 0
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+}
+
+// breakers holds a circuit breaker per host.
+type breakers struct {
+	mu     sync.Mutex
+	policy BreakerPolicy
+	hosts  map[string]*breaker
+}
+
+func newBreakers(p BreakerPolicy) *breakers {
+	return &breakers{
+		policy: p.withDefaults(),
+		hosts:  make(map[string]*breaker),
+	}
+}
+
+func (bs *breakers) get(host string) *breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	b, ok := bs.hosts[host]
+	if !ok {
+		b = &breaker{policy: bs.policy}
+		bs.hosts[host] = b
+	}
+
+	return b
+}
+
+// requestOutcome classifies a request's result for circuit breaking.
+func requestOutcome(req *http.Request, resp *http.Response, err error) outcome {
+	if req.Context().Err() != nil {
+		return outcomeIgnored
+	}
+
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		return outcomeFailure
+	}
+
+	return outcomeSuccess
+}
+
+// staleCacheKey returns the key under which a response is kept for serving
+// while its host's circuit is open.
+func staleCacheKey(key string) string {
+	return key + ":stale"
+}
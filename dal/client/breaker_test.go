@@ -0,0 +1,233 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nickhstr/goweb/internal/cachetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   BreakerPolicy
+		outcomes []outcome
+		open     bool
+	}{
+		{
+			"consecutive failures should trip the breaker",
+			BreakerPolicy{ConsecutiveFailures: 3},
+			[]outcome{outcomeFailure, outcomeFailure, outcomeFailure},
+			true,
+		},
+		{
+			"a success should reset consecutive failures",
+			BreakerPolicy{ConsecutiveFailures: 3},
+			[]outcome{outcomeFailure, outcomeFailure, outcomeSuccess, outcomeFailure},
+			false,
+		},
+		{
+			"ignored outcomes should not count",
+			BreakerPolicy{ConsecutiveFailures: 2},
+			[]outcome{outcomeFailure, outcomeIgnored, outcomeIgnored},
+			false,
+		},
+		{
+			"error rate should trip the breaker",
+			BreakerPolicy{ErrorRate: 0.5, MinRequests: 4},
+			[]outcome{outcomeSuccess, outcomeFailure, outcomeSuccess, outcomeFailure},
+			true,
+		},
+		{
+			"error rate should wait for the minimum requests",
+			BreakerPolicy{ErrorRate: 0.5, MinRequests: 4},
+			[]outcome{outcomeFailure, outcomeFailure, outcomeFailure},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			now := time.Now()
+			b := &breaker{policy: test.policy.withDefaults()}
+
+			for _, o := range test.outcomes {
+				trial, err := b.allow("foo.com", now)
+				assert.Nil(err)
+				b.record(trial, o, now)
+			}
+
+			_, err := b.allow("foo.com", now)
+			assert.Equal(test.open, err != nil)
+		})
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	b := &breaker{policy: BreakerPolicy{
+		ConsecutiveFailures: 1,
+		Cooldown:            time.Second,
+	}.withDefaults()}
+
+	allowed := func(now time.Time) (int, bool) {
+		trial, err := b.allow("foo.com", now)
+		return trial, err == nil
+	}
+
+	// a request allowed while closed, which completes once half-open
+	early, ok := allowed(now)
+	assert.True(ok)
+
+	trial, ok := allowed(now)
+	assert.True(ok)
+	b.record(trial, outcomeFailure, now)
+
+	_, ok = allowed(now.Add(500 * time.Millisecond))
+	assert.False(ok)
+
+	// after the cooldown, one probe is allowed
+	now = now.Add(time.Second)
+	probe, ok := allowed(now)
+	assert.True(ok)
+
+	_, ok = allowed(now)
+	assert.False(ok)
+
+	// requests which are not probes neither free a probe's place, nor
+	// close the circuit
+	b.record(early, outcomeSuccess, now)
+
+	_, ok = allowed(now)
+	assert.False(ok)
+
+	// a failed probe reopens the circuit
+	b.record(probe, outcomeFailure, now)
+
+	_, ok = allowed(now)
+	assert.False(ok)
+
+	// a probe of an earlier half-open period does not count
+	now = now.Add(time.Second)
+	trial, ok = allowed(now)
+	assert.True(ok)
+
+	b.record(probe, outcomeSuccess, now)
+
+	_, ok = allowed(now)
+	assert.False(ok)
+
+	// a successful probe closes it
+	b.record(trial, outcomeSuccess, now)
+
+	_, ok = allowed(now)
+	assert.True(ok)
+
+	_, ok = allowed(now)
+	assert.True(ok)
+}
+
+func TestClientDoBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		attempts int32
+		failing  int32
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("fresh"))
+	}))
+	defer srv.Close()
+
+	c := New().
+		SetHTTPClient(srv.Client()).
+		SetCacher(cachetest.NewMemory()).
+		SetTTL(time.Nanosecond).
+		SetBreakerPolicy(BreakerPolicy{
+			ConsecutiveFailures: 2,
+			Cooldown:            time.Hour,
+		})
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, nil)
+	atomic.StoreInt32(&failing, 1)
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Do(req)
+		assert.Nil(err)
+		assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	}
+
+	_, err := c.Do(req)
+	assert.True(errors.Is(err, ErrCircuitOpen))
+
+	var openErr *CircuitOpenError
+	if assert.True(errors.As(err, &openErr)) {
+		assert.Equal(req.URL.Host, openErr.Host)
+	}
+
+	assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestClientDoBreakerServeStale(t *testing.T) {
+	assert := assert.New(t)
+
+	var failing int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("fresh"))
+	}))
+	defer srv.Close()
+
+	cacher := cachetest.NewMemory()
+	c := New().
+		SetHTTPClient(srv.Client()).
+		SetCacher(cacher).
+		SetTTL(time.Minute).
+		SetBreakerPolicy(BreakerPolicy{
+			ConsecutiveFailures: 1,
+			Cooldown:            time.Hour,
+			ServeStale:          true,
+		})
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	_, err := c.Do(req)
+	assert.Nil(err)
+
+	// expire the fresh entry, and break the upstream
+	_ = cacher.Del(req.Context(), defaultCacheKeyPrefix+"GET:"+srv.URL)
+	atomic.StoreInt32(&failing, 1)
+
+	resp, err := c.Do(req)
+	assert.Nil(err)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+
+	_ = cacher.Del(req.Context(), defaultCacheKeyPrefix+"GET:"+srv.URL)
+
+	resp, err = c.Do(req)
+	if assert.Nil(err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal("fresh", string(body))
+	}
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is matched, using errors.Is, by errors returned for
+// requests rejected by a full bulkhead.
+var ErrOverloaded = errors.New("client: too many concurrent requests")
+
+// OverloadedError is returned when a request is rejected because its host
+// already has as many concurrent requests as its bulkhead allows, and no
+// slot became free within the queue timeout.
+type OverloadedError struct {
+	// Host is the upstream host whose bulkhead is full.
+	Host string
+	// InFlight is the number of the host's requests in flight.
+	InFlight int
+	// Limit is the host's concurrency limit.
+	Limit int
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("%s: %s (%d/%d)", ErrOverloaded.Error(), e.Host, e.InFlight, e.Limit)
+}
+
+// Is reports whether target is ErrOverloaded.
+func (e *OverloadedError) Is(target error) bool {
+	return target == ErrOverloaded
+}
+
+// BulkheadPolicy configures per-host concurrency limits (bulkheads), so
+// that a single slow upstream cannot tie up all of a service's goroutines
+// and connections.
+// Every attempt of a request, retries and hedges included, holds a slot
+// until its response body is closed; no slot is held while waiting to
+// retry, and hedges are only sent while a slot is free.
+type BulkheadPolicy struct {
+	// MaxConcurrent is the maximum number of concurrent requests to a
+	// host. Zero means no limit.
+	MaxConcurrent int
+
+	// QueueTimeout is how long a request waits for a slot before it is
+	// rejected with an OverloadedError. Zero rejects requests immediately
+	// when the bulkhead is full.
+	QueueTimeout time.Duration
+
+	// Adaptive, when true, adjusts each host's limit between
+	// MinConcurrent and MaxConcurrent: it grows slowly while requests
+	// succeed, and shrinks quickly when they fail, are throttled (429), or
+	// are slower than LatencyThreshold.
+	Adaptive bool
+
+	// MinConcurrent is the lowest limit an adaptive bulkhead shrinks to.
+	// Default is: 1.
+	MinConcurrent int
+
+	// LatencyThreshold is the latency above which an adaptive bulkhead
+	// treats a request as a sign of overload.
+	// Default is: latency is not considered.
+	LatencyThreshold time.Duration
+}
+
+// withDefaults returns a copy of the policy with defaults applied.
+func (p BulkheadPolicy) withDefaults() BulkheadPolicy {
+	if p.MinConcurrent == 0 {
+		p.MinConcurrent = 1
+	}
+
+	if p.MinConcurrent > p.MaxConcurrent {
+		p.MinConcurrent = p.MaxConcurrent
+	}
+
+	return p
+}
+
+// backoffRatio is how much an adaptive bulkhead's limit shrinks by on
+// signs of overload.
+const backoffRatio = 0.9
+
+// bulkhead limits a single host's concurrent requests.
+type bulkhead struct {
+	mu     sync.Mutex
+	host   string
+	policy BulkheadPolicy
+
+	limit    float64
+	inFlight int
+	// waiters are the channels of queued requests, first to last, which
+	// are closed when the request is given a slot.
+	waiters []chan struct{}
+}
+
+func (bh *bulkhead) full() bool {
+	return bh.policy.MaxConcurrent > 0 && bh.inFlight >= int(bh.limit)
+}
+
+func (bh *bulkhead) overloaded() error {
+	return &OverloadedError{bh.host, bh.inFlight, int(bh.limit)}
+}
+
+// report updates the bulkhead's concurrency limit metric. It must be called
+// with the lock held.
+// The metric is shared by every Client's bulkhead for the host, so reports
+// the limit last adapted by any of them; the in-flight metric, which is
+// counted across Clients, is updated as slots are taken and freed.
+func (bh *bulkhead) report() {
+	if bh.policy.MaxConcurrent > 0 {
+		concurrencyLimit.WithLabelValues(bh.host).Set(math.Floor(bh.limit))
+	}
+}
+
+// tryAcquire takes a slot for a request if one is free, without waiting.
+func (bh *bulkhead) tryAcquire() bool {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	if bh.full() {
+		return false
+	}
+
+	bh.inFlight++
+	requestsInFlight.WithLabelValues(bh.host).Inc()
+	bh.report()
+
+	return true
+}
+
+// acquire takes a slot for a request, waiting up to the queue timeout for
+// one to be free, returning an OverloadedError if none is.
+func (bh *bulkhead) acquire(ctx context.Context) error {
+	bh.mu.Lock()
+
+	if !bh.full() {
+		bh.inFlight++
+		requestsInFlight.WithLabelValues(bh.host).Inc()
+		bh.report()
+		bh.mu.Unlock()
+
+		return nil
+	}
+
+	if bh.policy.QueueTimeout <= 0 {
+		err := bh.overloaded()
+		bh.mu.Unlock()
+
+		return err
+	}
+
+	ready := make(chan struct{})
+	bh.waiters = append(bh.waiters, ready)
+	bh.mu.Unlock()
+
+	timer := time.NewTimer(bh.policy.QueueTimeout)
+	defer timer.Stop()
+
+	var err error
+
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	for i, w := range bh.waiters {
+		if w == ready {
+			bh.waiters = append(bh.waiters[:i], bh.waiters[i+1:]...)
+
+			if err == nil {
+				err = bh.overloaded()
+			}
+
+			return err
+		}
+	}
+
+	// given a slot while timing out
+	return nil
+}
+
+// release frees a request's slot, adapting the limit to the request's
+// outcome, and hands the slot to the next queued request.
+func (bh *bulkhead) release(o outcome, resp *http.Response, latency time.Duration) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	bh.inFlight--
+	requestsInFlight.WithLabelValues(bh.host).Dec()
+
+	if bh.policy.Adaptive && bh.policy.MaxConcurrent > 0 && o != outcomeIgnored {
+		p := bh.policy
+		throttled := resp != nil && resp.StatusCode == http.StatusTooManyRequests
+		slow := p.LatencyThreshold > 0 && latency > p.LatencyThreshold
+
+		if o == outcomeFailure || throttled || slow {
+			bh.limit = math.Max(float64(p.MinConcurrent), bh.limit*backoffRatio)
+		} else {
+			bh.limit = math.Min(float64(p.MaxConcurrent), bh.limit+1/bh.limit)
+		}
+	}
+
+	for len(bh.waiters) > 0 && !bh.full() {
+		ready := bh.waiters[0]
+		bh.waiters = bh.waiters[1:]
+		bh.inFlight++
+		requestsInFlight.WithLabelValues(bh.host).Inc()
+		close(ready)
+	}
+
+	bh.report()
+}
+
+// releaseOnClose frees a request's bulkhead slot once its response body is
+// closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+
+	return err
+}
+
+// doAttempt sends a single attempt of the request, holding a slot of its
+// host's bulkhead until the response body is closed.
+func (c *Client) doAttempt(req *http.Request) (*http.Response, error) {
+	bh := c.bulkheads.get(req.URL.Host)
+
+	if err := bh.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+
+	return c.doAcquired(bh, req)
+}
+
+// doAcquired sends a single attempt of the request, for which a slot of the
+// bulkhead was taken, freeing it once the response body is closed.
+func (c *Client) doAcquired(bh *bulkhead, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.chainedClient.Do(req)
+	o, latency := requestOutcome(req, resp, err), time.Since(start)
+
+	if err != nil {
+		bh.release(o, resp, latency)
+		return resp, err
+	}
+
+	resp.Body = &releaseOnClose{
+		ReadCloser: resp.Body,
+		release:    func() { bh.release(o, resp, latency) },
+	}
+
+	return resp, nil
+}
+
+// bulkheads holds a bulkhead per host.
+type bulkheads struct {
+	mu     sync.Mutex
+	policy BulkheadPolicy
+	hosts  map[string]*bulkhead
+}
+
+func newBulkheads(p BulkheadPolicy) *bulkheads {
+	return &bulkheads{
+		policy: p.withDefaults(),
+		hosts:  make(map[string]*bulkhead),
+	}
+}
+
+func (bs *bulkheads) get(host string) *bulkhead {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	bh, ok := bs.hosts[host]
+	if !ok {
+		bh = &bulkhead{
+			host:   host,
+			policy: bs.policy,
+			limit:  float64(bs.policy.MaxConcurrent),
+		}
+		bs.hosts[host] = bh
+	}
+
+	return bh
+}
+
+// inFlight returns the number of the host's requests in flight.
+func (bs *bulkheads) inFlight(host string) int {
+	bs.mu.Lock()
+	bh, ok := bs.hosts[host]
+	bs.mu.Unlock()
+
+	if !ok {
+		return 0
+	}
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	return bh.inFlight
+}
@@ -0,0 +1,320 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBulkhead(p BulkheadPolicy) *bulkhead {
+	return newBulkheads(p).get("foo.com")
+}
+
+func TestBulkheadAcquire(t *testing.T) {
+	assert := assert.New(t)
+	bh := newTestBulkhead(BulkheadPolicy{MaxConcurrent: 2})
+	ctx := context.Background()
+
+	assert.Nil(bh.acquire(ctx))
+	assert.Nil(bh.acquire(ctx))
+
+	err := bh.acquire(ctx)
+	assert.True(errors.Is(err, ErrOverloaded))
+
+	var overloaded *OverloadedError
+	if assert.True(errors.As(err, &overloaded)) {
+		assert.Equal(OverloadedError{"foo.com", 2, 2}, *overloaded)
+	}
+
+	bh.release(outcomeSuccess, nil, 0)
+	assert.Nil(bh.acquire(ctx))
+}
+
+func TestBulkheadUnlimited(t *testing.T) {
+	assert := assert.New(t)
+	bh := newTestBulkhead(BulkheadPolicy{})
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(bh.acquire(context.Background()))
+	}
+
+	assert.Equal(100, bh.inFlight)
+}
+
+func TestBulkheadInFlightMetric(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	gauge := requestsInFlight.WithLabelValues("inflight.com")
+	before := testutil.ToFloat64(gauge)
+
+	// bulkheads of different Clients, for the same host
+	a := newBulkheads(BulkheadPolicy{}).get("inflight.com")
+	b := newBulkheads(BulkheadPolicy{MaxConcurrent: 1}).get("inflight.com")
+
+	assert.Nil(a.acquire(ctx))
+	assert.Nil(a.acquire(ctx))
+	assert.Nil(b.acquire(ctx))
+	assert.Equal(before+3, testutil.ToFloat64(gauge))
+
+	b.release(outcomeSuccess, nil, 0)
+	assert.Equal(before+2, testutil.ToFloat64(gauge))
+
+	a.release(outcomeSuccess, nil, 0)
+	a.release(outcomeSuccess, nil, 0)
+	assert.Equal(before, testutil.ToFloat64(gauge))
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	assert := assert.New(t)
+	bh := newTestBulkhead(BulkheadPolicy{MaxConcurrent: 1, QueueTimeout: time.Second})
+	ctx := context.Background()
+
+	assert.Nil(bh.acquire(ctx))
+
+	acquired := make(chan error)
+	go func() { acquired <- bh.acquire(ctx) }()
+
+	// wait for the request to be queued
+	for {
+		bh.mu.Lock()
+		queued := len(bh.waiters)
+		bh.mu.Unlock()
+
+		if queued == 1 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	bh.release(outcomeSuccess, nil, 0)
+	assert.Nil(<-acquired)
+	assert.Equal(1, bh.inFlight)
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	assert := assert.New(t)
+	bh := newTestBulkhead(BulkheadPolicy{MaxConcurrent: 1, QueueTimeout: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	assert.Nil(bh.acquire(ctx))
+	assert.True(errors.Is(bh.acquire(ctx), ErrOverloaded))
+	assert.Empty(bh.waiters)
+
+	bh = newTestBulkhead(BulkheadPolicy{MaxConcurrent: 1, QueueTimeout: time.Second})
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	assert.Nil(bh.acquire(ctx))
+	assert.Equal(context.Canceled, bh.acquire(canceled))
+}
+
+func TestBulkheadAdaptive(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcome  outcome
+		resp     *http.Response
+		latency  time.Duration
+		expected int
+	}{
+		{
+			"failures should shrink the limit",
+			outcomeFailure,
+			nil,
+			0,
+			2,
+		},
+		{
+			"throttling should shrink the limit",
+			outcomeSuccess,
+			&http.Response{StatusCode: http.StatusTooManyRequests},
+			0,
+			2,
+		},
+		{
+			"slow requests should shrink the limit",
+			outcomeSuccess,
+			&http.Response{StatusCode: http.StatusOK},
+			time.Second,
+			2,
+		},
+		{
+			"ignored outcomes should not change the limit",
+			outcomeIgnored,
+			nil,
+			time.Second,
+			10,
+		},
+		{
+			"successes should not exceed the max",
+			outcomeSuccess,
+			&http.Response{StatusCode: http.StatusOK},
+			0,
+			10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			bh := newTestBulkhead(BulkheadPolicy{
+				MaxConcurrent:    10,
+				MinConcurrent:    2,
+				Adaptive:         true,
+				LatencyThreshold: 100 * time.Millisecond,
+			})
+
+			for i := 0; i < 50; i++ {
+				assert.Nil(bh.acquire(context.Background()))
+				bh.release(test.outcome, test.resp, test.latency)
+			}
+
+			assert.Equal(test.expected, int(bh.limit))
+		})
+	}
+
+	t.Run("successes should grow the limit", func(t *testing.T) {
+		assert := assert.New(t)
+		bh := newTestBulkhead(BulkheadPolicy{MaxConcurrent: 10, Adaptive: true})
+		bh.limit = 2
+
+		for i := 0; i < 10; i++ {
+			assert.Nil(bh.acquire(context.Background()))
+			bh.release(outcomeSuccess, &http.Response{StatusCode: http.StatusOK}, 0)
+		}
+
+		assert.Greater(bh.limit, 4.0)
+	})
+}
+
+func TestClientDoBulkhead(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		received = make(chan struct{})
+		unblock  = make(chan struct{})
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-unblock
+	}))
+	defer srv.Close()
+
+	c := New().
+		SetHTTPClient(srv.Client()).
+		SetSkipCache(true).
+		SetBulkheadPolicy(BulkheadPolicy{MaxConcurrent: 1})
+
+	u, _ := url.Parse(srv.URL)
+	done := make(chan *http.Response)
+
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		resp, err := c.Do(req)
+		assert.Nil(err)
+		done <- resp
+	}()
+
+	<-received
+	assert.Equal(1, c.InFlight(u.Host))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	_, err := c.Do(req)
+	assert.True(errors.Is(err, ErrOverloaded))
+
+	close(unblock)
+	resp := <-done
+
+	// the slot is held until the body is read
+	assert.Equal(1, c.InFlight(u.Host))
+
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	assert.Equal(0, c.InFlight(u.Host))
+}
+
+func TestClientDoBulkheadAttempts(t *testing.T) {
+	t.Run("should not hold slots between retries", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var attempts int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer srv.Close()
+
+		u, _ := url.Parse(srv.URL)
+		c := New().
+			SetHTTPClient(srv.Client()).
+			SetSkipCache(true).
+			SetBulkheadPolicy(BulkheadPolicy{MaxConcurrent: 1}).
+			SetRetryPolicy(RetryPolicy{MaxAttempts: 2})
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			resp, err := c.Do(req)
+			if assert.Nil(err) {
+				assert.Equal(http.StatusOK, resp.StatusCode)
+				resp.Body.Close()
+			}
+		}()
+
+		// the first attempt's slot is freed while waiting to retry
+		assert.Eventually(func() bool {
+			return atomic.LoadInt32(&attempts) == 1 && c.InFlight(u.Host) == 0
+		}, 500*time.Millisecond, time.Millisecond)
+
+		<-done
+		assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+		assert.Equal(0, c.InFlight(u.Host))
+	})
+
+	t.Run("should not hedge without a free slot", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var requests int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			time.Sleep(30 * time.Millisecond)
+		}))
+		defer srv.Close()
+
+		u, _ := url.Parse(srv.URL)
+		c := New().
+			SetHTTPClient(srv.Client()).
+			SetSkipCache(true).
+			SetBulkheadPolicy(BulkheadPolicy{MaxConcurrent: 1}).
+			SetHedgePolicy(HedgePolicy{Enabled: true, Delay: time.Millisecond, MaxRate: 1})
+
+		for i := 0; i < 3; i++ {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			resp, err := c.Do(req)
+			if assert.Nil(err) {
+				resp.Body.Close()
+			}
+		}
+
+		assert.Equal(int32(3), atomic.LoadInt32(&requests))
+		assert.Equal(0, c.InFlight(u.Host))
+	})
+}
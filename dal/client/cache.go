@@ -0,0 +1,320 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cachedResponse is a response as stored in the cache.
+type cachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// Expires is when the response becomes stale, and must be revalidated
+	// before it is used again.
+	Expires time.Time
+
+	// Vary lists the request headers which select the response. Entries
+	// stored under a request's base key with Vary set hold no response;
+	// they only point to the variant keys under which responses are stored.
+	Vary []string `json:",omitempty"`
+}
+
+// cacheableStatuses are the response status codes which may be cached,
+// following RFC 7231's list of heuristically cacheable codes (less 206, as
+// range requests are not cached).
+var cacheableStatuses = map[int]struct{}{
+	http.StatusOK:                   {},
+	http.StatusNonAuthoritativeInfo: {},
+	http.StatusNoContent:            {},
+	http.StatusMultipleChoices:      {},
+	http.StatusMovedPermanently:     {},
+	http.StatusNotFound:             {},
+	http.StatusMethodNotAllowed:     {},
+	http.StatusGone:                 {},
+	http.StatusRequestURITooLong:    {},
+	http.StatusNotImplemented:       {},
+}
+
+// conditionalHeaders are request headers which make a request conditional
+// or partial. Such requests bypass the cache, as their responses depend on
+// what the caller already has.
+var conditionalHeaders = []string{
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Range",
+	"If-Unmodified-Since",
+	"Range",
+}
+
+// cacheable reports whether the request's response may come from, or be
+// stored in, the cache.
+func cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	for _, h := range conditionalHeaders {
+		if req.Header.Get(h) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// baseCacheKey returns the key under which the request's response, or its
+// variants' pointer, is stored: the key from the request's context, if
+// any, or else one made from its method and URL.
+// Requests with an Authorization header have a hash of it added to their
+// key, so that one user's responses are never served to another.
+func (c *Client) baseCacheKey(req *http.Request) string {
+	key, ok := cacheKeyFromContext(req.Context())
+	if !ok {
+		key = req.Method + ":" + req.URL.String()
+	}
+
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		key += "|auth=" + hex.EncodeToString(sum[:16])
+	}
+
+	return c.cacheKeyPrefix + key
+}
+
+// sharedCacheable reports whether the response to a request with
+// credentials may be stored in a shared cache, as RFC 7234 section 3.2
+// allows only when its Cache-Control header says so.
+func sharedCacheable(h http.Header) bool {
+	cc := parseCacheControl(h)
+
+	return cc.has("public") || cc.has("s-maxage") || cc.has("must-revalidate")
+}
+
+// variantCacheKey returns the key under which a response which varies by
+// the given request headers is stored.
+func variantCacheKey(base string, vary []string, h http.Header) string {
+	var b strings.Builder
+
+	b.WriteString(base)
+
+	for _, name := range vary {
+		b.WriteString("|")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(h.Values(name), ","))
+	}
+
+	return b.String()
+}
+
+// varyHeaders returns the sorted, canonical request header names listed in
+// the response's Vary header. It returns false if the response varies by
+// "*", and so cannot be cached.
+func varyHeaders(h http.Header) ([]string, bool) {
+	seen := make(map[string]struct{})
+
+	for _, val := range h.Values("Vary") {
+		for _, name := range strings.Split(val, ",") {
+			name = strings.TrimSpace(name)
+
+			switch name {
+			case "":
+				continue
+			case "*":
+				return nil, false
+			}
+
+			seen[http.CanonicalHeaderKey(name)] = struct{}{}
+		}
+	}
+
+	vary := make([]string, 0, len(seen))
+	for name := range seen {
+		vary = append(vary, name)
+	}
+
+	sort.Strings(vary)
+
+	return vary, true
+}
+
+// fresh reports whether the response may be used without revalidation.
+func (cr *cachedResponse) fresh(now time.Time) bool {
+	return now.Before(cr.Expires)
+}
+
+// revalidatable reports whether the response has validators, with which a
+// conditional request can be made once it is stale.
+func (cr *cachedResponse) revalidatable() bool {
+	return cr.Header.Get("ETag") != "" || cr.Header.Get("Last-Modified") != ""
+}
+
+// setValidators makes the request conditional on the cached response
+// having changed.
+func (cr *cachedResponse) setValidators(req *http.Request) {
+	if etag := cr.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified := cr.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// refresh updates the cached response with the headers of a 304 (Not
+// Modified) response.
+func (cr *cachedResponse) refresh(h http.Header) {
+	for key, values := range h {
+		// the 304 has no body, so says nothing about the stored one's length
+		if key == "Content-Length" {
+			continue
+		}
+
+		cr.Header[key] = values
+	}
+}
+
+// response returns an http.Response for the cached response.
+func (cr *cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(cr.StatusCode),
+		StatusCode:    cr.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cr.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(cr.Body)),
+		ContentLength: int64(len(cr.Body)),
+		Request:       req,
+	}
+}
+
+// cacheGet returns the cached response stored under the key, if any.
+func (c *Client) cacheGet(ctx context.Context, key string) (*cachedResponse, bool) {
+	data, err := c.cacher.Get(ctx, key)
+	if err != nil || len(data) == 0 {
+		return nil, false
+	}
+
+	var cr cachedResponse
+	if err := json.Unmarshal(data, &cr); err != nil {
+		log.Debug().Err(err).Str("key", key).Msg("Failed to unmarshal cached response")
+		return nil, false
+	}
+
+	return &cr, true
+}
+
+// cacheSet stores the cached response under the key, swallowing any
+// errors.
+func (c *Client) cacheSet(ctx context.Context, key string, cr *cachedResponse, d time.Duration) {
+	data, err := json.Marshal(cr)
+	if err != nil {
+		log.Debug().Err(err).Str("key", key).Msg("Failed to marshal cached response")
+		return
+	}
+
+	_ = c.cacher.Set(ctx, key, data, d)
+}
+
+// cacheLookup finds the cached response for the request, following the
+// pointer to its variant if the response varies. The returned key is where
+// the response is, or would be, stored.
+func (c *Client) cacheLookup(ctx context.Context, req *http.Request) (string, *cachedResponse) {
+	key := c.baseCacheKey(req)
+
+	cr, ok := c.cacheGet(ctx, key)
+	if !ok {
+		return key, nil
+	}
+
+	if len(cr.Vary) == 0 {
+		return key, cr
+	}
+
+	key = variantCacheKey(key, cr.Vary, req.Header)
+
+	cr, ok = c.cacheGet(ctx, key)
+	if !ok {
+		return key, nil
+	}
+
+	return key, cr
+}
+
+// retention returns how long a cached response is kept in the Cacher:
+// its TTL, plus the revalidation window if it has validators.
+// A zero retention means the response must not be stored.
+func (c *Client) retention(cr *cachedResponse, ttl time.Duration) time.Duration {
+	if cr.revalidatable() {
+		return ttl + c.revalidateTTL
+	}
+
+	return ttl
+}
+
+// cacheStore stores the response for the request, under a variant key if
+// the response varies by request headers.
+func (c *Client) cacheStore(ctx context.Context, req *http.Request, resp *http.Response, body []byte, ttl time.Duration) {
+	if _, ok := cacheableStatuses[resp.StatusCode]; !ok {
+		return
+	}
+
+	// credentials added by interceptors are not part of the cache key, so
+	// the response may only be stored if any user may be served it
+	if sent := resp.Request; sent != nil &&
+		sent.Header.Get("Authorization") != req.Header.Get("Authorization") &&
+		!sharedCacheable(resp.Header) {
+		return
+	}
+
+	vary, ok := varyHeaders(resp.Header)
+	if !ok {
+		return
+	}
+
+	cr := &cachedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		Expires:    time.Now().Add(ttl),
+	}
+	keep := c.retention(cr, ttl)
+	key := c.baseCacheKey(req)
+
+	// a response which is immediately stale, and cannot be revalidated,
+	// is of no use; a Cacher may also treat a zero duration as "forever"
+	if keep <= 0 {
+		return
+	}
+
+	serveStale := c.breakers != nil && c.breakers.policy.ServeStale
+
+	if len(vary) > 0 {
+		pointerTTL := keep
+		if serveStale && c.breakers.policy.StaleTTL > pointerTTL {
+			pointerTTL = c.breakers.policy.StaleTTL
+		}
+
+		c.cacheSet(ctx, key, &cachedResponse{Vary: vary}, pointerTTL)
+		key = variantCacheKey(key, vary, req.Header)
+	}
+
+	c.cacheSet(ctx, key, cr, keep)
+
+	// only keep successful responses to serve while the circuit is open
+	if serveStale && resp.StatusCode < http.StatusMultipleChoices {
+		c.cacheSet(ctx, staleCacheKey(key), cr, c.breakers.policy.StaleTTL)
+	}
+}
@@ -0,0 +1,321 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nickhstr/goweb/internal/cachetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientDoCachesFullResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	var hits int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer srv.Close()
+
+	c := New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		resp, err := c.Do(req)
+
+		if assert.Nil(err) {
+			body, _ := ioutil.ReadAll(resp.Body)
+			assert.Equal(http.StatusNotFound, resp.StatusCode)
+			assert.Equal("application/json", resp.Header.Get("Content-Type"))
+			assert.Equal(`{"error":"not found"}`, string(body))
+		}
+	}
+
+	assert.Equal(int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestClientDoCacheVary(t *testing.T) {
+	assert := assert.New(t)
+
+	var hits int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	defer srv.Close()
+
+	c := New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+
+	for _, lang := range []string{"en", "fr", "en", "fr"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Header.Set("Accept-Language", lang)
+
+		resp, err := c.Do(req)
+		if assert.Nil(err) {
+			body, _ := ioutil.ReadAll(resp.Body)
+			assert.Equal(lang, string(body))
+		}
+	}
+
+	assert.Equal(int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestClientDoCacheCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		cacheControl string
+		interceptor  bool
+		expected     []string
+	}{
+		{
+			"should cache private responses per credential",
+			"max-age=60",
+			false,
+			[]string{"alice", "bob", "alice", "bob"},
+		},
+		{
+			"should not cache private responses to interceptor credentials",
+			"max-age=60",
+			true,
+			[]string{"Bearer 1", "Bearer 2", "Bearer 3", "Bearer 4"},
+		},
+		{
+			"should cache public responses to interceptor credentials",
+			"public, max-age=60",
+			true,
+			[]string{"Bearer 1", "Bearer 1", "Bearer 1", "Bearer 1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			c := New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+
+			var tokens int32
+
+			if test.interceptor {
+				c.Use(BearerTokenFunc(func(context.Context) (string, error) {
+					return strconv.Itoa(int(atomic.AddInt32(&tokens, 1))), nil
+				}))
+			}
+
+			for i, expected := range test.expected {
+				req, _ := http.NewRequest(http.MethodGet, srv.URL+"?cc="+url.QueryEscape(test.cacheControl), nil)
+				if !test.interceptor {
+					req.Header.Set("Authorization", []string{"alice", "bob"}[i%2])
+				}
+
+				resp, err := c.Do(req)
+				if assert.Nil(err) {
+					body, _ := ioutil.ReadAll(resp.Body)
+					assert.Equal(expected, string(body))
+				}
+			}
+		})
+	}
+}
+
+func TestClientDoCacheRevalidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		validator    string
+		condition    string
+		expectedHits int32
+	}{
+		{
+			"should revalidate with ETag",
+			"ETag",
+			"If-None-Match",
+			2,
+		},
+		{
+			"should revalidate with Last-Modified",
+			"Last-Modified",
+			"If-Modified-Since",
+			2,
+		},
+		{
+			"should refetch without validators",
+			"",
+			"",
+			2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var (
+				hits        int32
+				notModified int32
+			)
+
+			validator := "Mon, 02 Jan 2006 15:04:05 GMT"
+			if test.validator == "ETag" {
+				validator = `"abc"`
+			}
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&hits, 1)
+
+				if test.condition != "" && r.Header.Get(test.condition) == validator {
+					atomic.AddInt32(&notModified, 1)
+					w.Header().Set("X-Refreshed", "true")
+					w.WriteHeader(http.StatusNotModified)
+
+					return
+				}
+
+				if test.validator != "" {
+					w.Header().Set(test.validator, validator)
+				}
+
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("foo"))
+			}))
+			defer srv.Close()
+
+			c := New().
+				SetHTTPClient(srv.Client()).
+				SetCacher(cachetest.NewMemory()).
+				SetTTL(time.Nanosecond)
+
+			var resp *http.Response
+
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+				var err error
+				resp, err = c.Do(req)
+				assert.Nil(err)
+			}
+
+			body, _ := ioutil.ReadAll(resp.Body)
+			assert.Equal(http.StatusOK, resp.StatusCode)
+			assert.Equal("text/plain", resp.Header.Get("Content-Type"))
+			assert.Equal("foo", string(body))
+			assert.Equal(test.expectedHits, atomic.LoadInt32(&hits))
+
+			if test.validator != "" {
+				assert.Equal(int32(1), atomic.LoadInt32(&notModified))
+				assert.Equal("true", resp.Header.Get("X-Refreshed"))
+			} else {
+				assert.Equal(int32(0), atomic.LoadInt32(&notModified))
+			}
+		})
+	}
+}
+
+func TestClientDoCacheBypass(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		vary   string
+	}{
+		{
+			"should not cache responses varying by everything",
+			http.Header{},
+			"*",
+		},
+		{
+			"should not cache conditional requests",
+			http.Header{"If-None-Match": []string{`"abc"`}},
+			"",
+		},
+		{
+			"should not cache range requests",
+			http.Header{"Range": []string{"bytes=0-1"}},
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var hits int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&hits, 1)
+
+				if test.vary != "" {
+					w.Header().Set("Vary", test.vary)
+				}
+
+				w.Write([]byte("foo"))
+			}))
+			defer srv.Close()
+
+			c := New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+				req.Header = test.header.Clone()
+
+				_, err := c.Do(req)
+				assert.Nil(err)
+			}
+
+			assert.Equal(int32(2), atomic.LoadInt32(&hits))
+		})
+	}
+}
+
+func Test_varyHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected []string
+		ok       bool
+	}{
+		{
+			"should return no headers",
+			http.Header{},
+			[]string{},
+			true,
+		},
+		{
+			"should return sorted, canonical headers",
+			http.Header{"Vary": []string{"accept-language, Accept", "accept"}},
+			[]string{"Accept", "Accept-Language"},
+			true,
+		},
+		{
+			"should not allow a wildcard",
+			http.Header{"Vary": []string{"Accept, *"}},
+			nil,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			vary, ok := varyHeaders(test.header)
+
+			assert.Equal(test.ok, ok)
+			assert.Equal(test.expected, vary)
+		})
+	}
+}
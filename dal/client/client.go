@@ -3,22 +3,25 @@ package client
 import (
 	"bytes"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"regexp"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/nickhstr/goweb/cache"
 	"github.com/nickhstr/goweb/logger"
+	"github.com/nickhstr/goweb/requestid"
+	"github.com/nickhstr/goweb/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const defaultCacheKeyPrefix = "dal:"
 
 var (
 	log               = logger.New("dal")
-	maxAgeRegex       = regexp.MustCompile(`max-age=\d+`)
 	defaultHTTPClient = &http.Client{
 		Timeout: 15 * time.Second,
 	}
@@ -29,25 +32,54 @@ var (
 // for GET requests.
 type Client struct {
 	httpClient     *http.Client
+	chainedClient  *http.Client
+	interceptors   []Interceptor
 	cacher         cache.Cacher
 	cacheKeyPrefix string
 	skipCache      bool
 	ttl            time.Duration
+	minTTL         time.Duration
+	maxTTL         time.Duration
+	revalidateTTL  time.Duration
+
+	endpointLabeler EndpointLabeler
+	maxResponseSize int64
+	retryPolicy     RetryPolicy
+	breakers        *breakers
+	bulkheads       *bulkheads
+	hedgers         *hedgers
 }
 
 // New returns a new Client instance.
 func New() *Client {
-	return &Client{
+	c := &Client{
 		httpClient:     defaultHTTPClient,
+		interceptors:   []Interceptor{RequestID},
 		cacher:         cache.Default(),
 		cacheKeyPrefix: defaultCacheKeyPrefix,
-		ttl:            60 * time.Second,
+		revalidateTTL:  time.Hour,
+		bulkheads:      newBulkheads(BulkheadPolicy{}),
 	}
+	c.buildHTTPClient()
+
+	return c
 }
 
 // SetHTTPClient sets the Client's http.Client.
 func (c *Client) SetHTTPClient(httpClient *http.Client) *Client {
 	c.httpClient = httpClient
+	c.buildHTTPClient()
+
+	return c
+}
+
+// Use adds interceptors to the Client, after any already added.
+// Interceptors act on every request sent by the Client, including
+// retries and hedge requests, but not requests served from the cache.
+func (c *Client) Use(i ...Interceptor) *Client {
+	c.interceptors = append(c.interceptors[:len(c.interceptors):len(c.interceptors)], i...)
+	c.buildHTTPClient()
+
 	return c
 }
 
@@ -70,36 +102,154 @@ func (c *Client) SetSkipCache(skip bool) *Client {
 	return c
 }
 
-// SetTTL sets the Time to Live (TTL) for
-// a request's cached response.
+// SetTTL sets a fixed Time to Live (TTL) for
+// a request's cached response, overriding the
+// freshness given by the response's headers.
+// Default is: zero, deriving each response's TTL
+// from its Cache-Control, Expires and Age headers.
 func (c *Client) SetTTL(ttl time.Duration) *Client {
 	c.ttl = ttl
 	return c
 }
 
+// SetMinTTL sets the minimum TTL for responses whose
+// TTL is derived from their headers. Responses which
+// must always be revalidated (e.g. "no-cache") are
+// not affected.
+func (c *Client) SetMinTTL(ttl time.Duration) *Client {
+	c.minTTL = ttl
+	return c
+}
+
+// SetMaxTTL sets the maximum TTL for responses whose
+// TTL is derived from their headers.
+func (c *Client) SetMaxTTL(ttl time.Duration) *Client {
+	c.maxTTL = ttl
+	return c
+}
+
+// SetRevalidateTTL sets how long cached responses with validators (an
+// ETag or Last-Modified header) are kept after they become stale, so they
+// can be revalidated with a conditional request rather than fetched again.
+// Default is: 1 hour.
+func (c *Client) SetRevalidateTTL(ttl time.Duration) *Client {
+	c.revalidateTTL = ttl
+	return c
+}
+
+// SetRetryPolicy sets the policy for retrying failed requests.
+// By default, requests are not retried.
+func (c *Client) SetRetryPolicy(p RetryPolicy) *Client {
+	c.retryPolicy = p
+	return c
+}
+
+// SetBreakerPolicy sets the policy for per-host circuit breaking.
+// By default, there is no circuit breaking.
+func (c *Client) SetBreakerPolicy(p BreakerPolicy) *Client {
+	if !p.enabled() {
+		c.breakers = nil
+		return c
+	}
+
+	c.breakers = newBreakers(p)
+
+	return c
+}
+
+// SetBulkheadPolicy sets the policy for limiting concurrent requests
+// per host.
+// By default, concurrent requests are not limited.
+func (c *Client) SetBulkheadPolicy(p BulkheadPolicy) *Client {
+	c.bulkheads = newBulkheads(p)
+	return c
+}
+
+// InFlight returns the number of requests to the host (e.g.
+// "example.com:8080") currently in flight.
+func (c *Client) InFlight(host string) int {
+	return c.bulkheads.inFlight(host)
+}
+
+// SetHedgePolicy sets the policy for hedging slow requests.
+// By default, requests are not hedged.
+func (c *Client) SetHedgePolicy(p HedgePolicy) *Client {
+	if !p.Enabled {
+		c.hedgers = nil
+		return c
+	}
+
+	c.hedgers = newHedgers(p)
+
+	return c
+}
+
+// SetMaxResponseSize sets the maximum size, in bytes, of response bodies
+// read by the JSON helper methods, and of responses cached. Larger bodies
+// fail with ErrResponseTooLarge, and are never cached.
+// Default is: no limit.
+func (c *Client) SetMaxResponseSize(n int64) *Client {
+	c.maxResponseSize = n
+	return c
+}
+
+// SetEndpointLabeler sets the function used to label a request's metrics
+// with an endpoint name.
+// By default, the endpoint label is empty; requests are only distinguished
+// by host, method, status and cache usage.
+func (c *Client) SetEndpointLabeler(l EndpointLabeler) *Client {
+	c.endpointLabeler = l
+	return c
+}
+
 // Do sends the request, maybe caches the response,
 // and returns the response.
+// Caching may be controlled per request with the request's context;
+// see WithTTL, WithCacheKey, WithForceRefresh and WithSkipCache.
+// GET and HEAD responses are cached in full (status, headers and body),
+// keyed by method, URL, Authorization header and any request headers named
+// by the response's Vary header; responses to credentials added by
+// interceptors are only cached if shared caches may store them. Once stale, cached responses with an ETag or Last-Modified
+// header are revalidated with a conditional request; a 304 (Not Modified)
+// response refreshes the cached response, which is returned.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
-	var (
-		resp = new(http.Response)
-		err  error
-	)
-
 	if req == nil {
 		return nil, errors.New("client: nil request supplied")
 	}
 
 	start := time.Now()
 	url := req.URL.String()
-	cacheKey := c.cacheKeyPrefix + url
-	ctx := req.Context()
 
-	// only try cache for GET requests
-	skipCache := c.skipCache || c.cacher == nil || req.Method != http.MethodGet
+	ctx, span := tracing.Tracer().Start(
+		req.Context(),
+		"HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(req)...),
+	)
+	defer span.End()
+
+	req = cloneRequest(req.WithContext(ctx))
+	tracing.Inject(ctx, req.Header)
+
+	lc := log.With()
+	if id := requestID(req); id != "" {
+		lc = lc.Str("requestID", id)
+	}
+
+	log := lc.Logger()
+
+	var (
+		useCache = !c.skipCache && !skipCacheFromContext(ctx) && c.cacher != nil && cacheable(req)
+		cacheKey = c.baseCacheKey(req)
+		cached   *cachedResponse
+	)
 
-	if !skipCache {
-		cachedResp, err := c.cacher.Get(ctx, cacheKey)
-		if err == nil {
+	// a "no cache" context forces a refresh: cached responses are skipped,
+	// but the fresh response is still cached
+	if useCache && cache.UseCache(ctx) {
+		cacheKey, cached = c.cacheLookup(ctx, req)
+
+		if cached != nil && cached.fresh(time.Now()) {
 			log.Info().
 				Str("url", url).
 				Str("method", req.Method).
@@ -107,14 +257,36 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 				Bool("cache", true).
 				Msg("DAL request")
 
-			resp.Body = ioutil.NopCloser(bytes.NewBuffer(cachedResp))
-			resp.StatusCode = http.StatusOK
+			span.SetAttributes(attribute.Bool("cache", true))
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(cached.StatusCode)...)
+			c.observeResponse(req, cached.StatusCode, cacheHit, start)
 
-			return resp, err
+			return cached.response(req), nil
+		}
+
+		if cached != nil && cached.revalidatable() {
+			cached.setValidators(req)
+		} else {
+			cached = nil
+		}
+	}
+
+	resp, err := c.guardedSend(req)
+	if errors.Is(err, ErrCircuitOpen) && useCache && c.breakers.policy.ServeStale {
+		if stale, ok := c.cacheGet(ctx, staleCacheKey(cacheKey)); ok {
+			log.Warn().
+				Str("url", url).
+				Str("method", req.Method).
+				Err(err).
+				Msg("Serving stale DAL response")
+
+			span.SetAttributes(attribute.Bool("cache", true), attribute.Bool("stale", true))
+			c.observeResponse(req, stale.StatusCode, cacheStale, start)
+
+			return stale.response(req), nil
 		}
 	}
 
-	resp, err = c.httpClient.Do(req)
 	if err != nil {
 		log.Error().
 			Str("url", url).
@@ -122,68 +294,141 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 			Err(err).
 			Msg("Failed to do request")
 
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		c.observeError(req, err)
+
 		return resp, err
 	}
 
-	if c.ttl == 0 {
-		c.ttl = ttlFromResponse(resp)
-	}
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(resp.StatusCode)...)
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode))
+
+	ttl, storable := c.responseTTL(ctx, resp)
+	revalidated := cached != nil && resp.StatusCode == http.StatusNotModified
 
 	log.Info().
 		Str("url", url).
 		Str("method", req.Method).
 		Str("responseTime", time.Since(start).String()).
-		Dur("ttl", c.ttl).
-		Bool("cache", false).
+		Dur("ttl", ttl).
+		Bool("cache", revalidated).
+		Bool("revalidated", revalidated).
 		Msg("DAL request")
 
-	if !skipCache {
-		// read body to store in cache
-		body, err := ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
+	if revalidated {
+		discard(resp)
+
+		// the 304's headers may update the cached response's freshness
+		cached.refresh(resp.Header)
+		ttl, storable = c.responseTTL(ctx, cached.response(req))
+
+		if keep := c.retention(cached, ttl); storable && keep > 0 {
+			cached.Expires = time.Now().Add(ttl)
+			c.cacheSet(ctx, cacheKey, cached, keep)
+		} else {
+			_ = c.cacher.Del(ctx, cacheKey)
+		}
+
+		span.SetAttributes(attribute.Bool("cache", true), attribute.Bool("revalidated", true))
+		c.observeResponse(req, cached.StatusCode, cacheRevalidated, start)
+
+		return cached.response(req), nil
+	}
 
+	span.SetAttributes(attribute.Bool("cache", false))
+	c.observeResponse(req, resp.StatusCode, cacheMiss, start)
+
+	if useCache && storable {
+		// read body to store in cache, up to the maximum response size
+		r := io.Reader(resp.Body)
+		if c.maxResponseSize > 0 {
+			r = io.LimitReader(resp.Body, c.maxResponseSize+1)
+		}
+
+		body, err := ioutil.ReadAll(r)
 		if err != nil {
+			resp.Body.Close()
 			return resp, err
 		}
 
-		// Try to store response in cache,
-		// swallowing any errors
-		_ = c.cacher.Set(ctx, cacheKey, body, c.ttl)
+		if c.maxResponseSize > 0 && int64(len(body)) > c.maxResponseSize {
+			// too large to cache; the caller reads the rest of the body
+			resp.Body = &multiReadCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		c.cacheStore(ctx, req, resp, body, ttl)
 
 		// restore response body with body just read
 		resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 	}
 
-	return resp, err
+	return resp, nil
 }
 
-// ttlFromResponse attempts to get a TTL value from
-// a response's "cache-control" header, otherwise
-// returning a default.
-func ttlFromResponse(r *http.Response) time.Duration {
-	// Number of seconds for ttl
-	var ttl int
+// guardedSend does the request, subject to the Client's circuit breakers.
+// Bulkheads limit the request's attempts, as they are sent.
+func (c *Client) guardedSend(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	var (
+		b     *breaker
+		trial int
+	)
+
+	if c.breakers != nil {
+		b = c.breakers.get(host)
 
-	headerKey := http.CanonicalHeaderKey("Cache-Control")
-	cacheControlValues := r.Header[headerKey]
+		var err error
+		if trial, err = b.allow(host, time.Now()); err != nil {
+			return nil, err
+		}
+	}
 
-	for _, val := range cacheControlValues {
-		match := maxAgeRegex.FindString(val)
+	resp, err := c.send(req)
 
-		if match != "" {
-			maxAgeKeyVal := strings.Split(match, "=")
+	if b != nil {
+		o := requestOutcome(req, resp, err)
 
-			maxAge, err := strconv.Atoi(maxAgeKeyVal[1])
-			if err == nil {
-				ttl = maxAge
-				break
-			}
+		// a rejected request says nothing about the upstream's health
+		if errors.Is(err, ErrOverloaded) {
+			o = outcomeIgnored
 		}
+
+		b.record(trial, o, time.Now())
+	}
+
+	return resp, err
+}
+
+// cloneRequest returns a copy of the request, whose headers are safe to
+// modify without affecting the caller's request.
+func cloneRequest(req *http.Request) *http.Request {
+	r := req.Clone(req.Context())
+	if r.Header == nil {
+		r.Header = make(http.Header)
 	}
 
-	if ttl == 0 {
-		ttl = 60
+	return r
+}
+
+// requestID returns the request's ID, from its X-Request-ID header or,
+// as the RequestID interceptor would forward it, its context.
+func requestID(req *http.Request) string {
+	if id := req.Header.Get(requestid.Header); id != "" {
+		return id
 	}
 
-	return time.Duration(ttl) * time.Second
+	id, _ := requestid.FromContext(req.Context())
+
+	return id
+}
+
+// multiReadCloser reads from a reader, and closes a closer, e.g. a
+// partially read response body.
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
 }
@@ -2,13 +2,20 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"testing"
 	"time"
 
+	"github.com/nickhstr/goweb/instrument"
+	"github.com/nickhstr/goweb/internal/cachetest"
+	"github.com/nickhstr/goweb/requestid"
+	"github.com/nickhstr/goweb/tracing"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/h2non/gock.v1"
 )
 
@@ -72,10 +79,14 @@ func TestClientDo(t *testing.T) {
 }
 
 func Test_ttlFromResponse(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Add(-10 * time.Second).Format(http.TimeFormat)
+
 	tests := []struct {
 		name string
 		*http.Response
-		expected time.Duration
+		expected         time.Duration
+		expectedStorable bool
 	}{
 		{
 			"should get TTL from response",
@@ -87,6 +98,7 @@ func Test_ttlFromResponse(t *testing.T) {
 				},
 			},
 			900 * time.Second,
+			true,
 		},
 		{
 			"should get TTL from response with multiple cache-control header values",
@@ -100,18 +112,251 @@ func Test_ttlFromResponse(t *testing.T) {
 				},
 			},
 			300 * time.Second,
+			true,
 		},
 		{
 			"should use default TTL",
 			&http.Response{},
 			60 * time.Second,
+			true,
+		},
+		{
+			"should prefer s-maxage",
+			&http.Response{
+				Header: http.Header{
+					"Cache-Control": []string{"max-age=300, s-maxage=600"},
+				},
+			},
+			600 * time.Second,
+			true,
+		},
+		{
+			"should subtract age",
+			&http.Response{
+				Header: http.Header{
+					"Cache-Control": []string{"max-age=300"},
+					"Age":           []string{"100"},
+				},
+			},
+			200 * time.Second,
+			true,
+		},
+		{
+			"should subtract time since date",
+			&http.Response{
+				Header: http.Header{
+					"Cache-Control": []string{"max-age=300"},
+					"Date":          []string{date},
+				},
+			},
+			290 * time.Second,
+			true,
+		},
+		{
+			"should get TTL from expires",
+			&http.Response{
+				Header: http.Header{
+					"Date":    []string{date},
+					"Expires": []string{now.Add(time.Minute).Format(http.TimeFormat)},
+				},
+			},
+			60 * time.Second,
+			true,
+		},
+		{
+			"should treat invalid expires as expired",
+			&http.Response{
+				Header: http.Header{
+					"Expires": []string{"0"},
+				},
+			},
+			0,
+			true,
+		},
+		{
+			"should not be fresh with no-cache",
+			&http.Response{
+				Header: http.Header{
+					"Cache-Control": []string{"no-cache, max-age=300"},
+				},
+			},
+			0,
+			true,
+		},
+		{
+			"should not be fresh with zero max-age",
+			&http.Response{
+				Header: http.Header{
+					"Cache-Control": []string{"max-age=0"},
+				},
+			},
+			0,
+			true,
+		},
+		{
+			"should not store with no-store",
+			&http.Response{
+				Header: http.Header{
+					"Cache-Control": []string{"no-store"},
+				},
+			},
+			0,
+			false,
+		},
+		{
+			"should not store with private",
+			&http.Response{
+				Header: http.Header{
+					"Cache-Control": []string{"Private, max-age=300"},
+				},
+			},
+			0,
+			false,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			assert := assert.New(t)
-			assert.Equal(test.expected, ttlFromResponse(test.Response))
+			ttl, storable := ttlFromResponse(test.Response, now)
+
+			assert.Equal(test.expected, ttl)
+			assert.Equal(test.expectedStorable, storable)
 		})
 	}
 }
+
+func TestClientResponseTTL(t *testing.T) {
+	tests := []struct {
+		name         string
+		client       *Client
+		cacheControl string
+		expected     time.Duration
+	}{
+		{
+			"should use fixed TTL",
+			New().SetTTL(time.Minute).SetMaxTTL(time.Second),
+			"max-age=300",
+			time.Minute,
+		},
+		{
+			"should clamp to min TTL",
+			New().SetMinTTL(time.Minute),
+			"max-age=10",
+			time.Minute,
+		},
+		{
+			"should clamp to max TTL",
+			New().SetMaxTTL(time.Minute),
+			"max-age=300",
+			time.Minute,
+		},
+		{
+			"should not clamp responses which must be revalidated",
+			New().SetMinTTL(time.Minute),
+			"no-cache",
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			resp := &http.Response{
+				Header: http.Header{"Cache-Control": []string{test.cacheControl}},
+			}
+
+			ttl, storable := test.client.responseTTL(context.Background(), resp)
+			assert.True(storable)
+			assert.Equal(test.expected, ttl)
+		})
+	}
+}
+
+func TestClientDoDoesNotMutateTTL(t *testing.T) {
+	defer gock.Off()
+
+	assert := assert.New(t)
+
+	gock.New("http://foo.com").
+		Get("/max-age").
+		Reply(http.StatusOK).
+		SetHeader("Cache-Control", "max-age=900").
+		BodyString("ok")
+
+	c := New().SetCacher(cachetest.NewMemory())
+	req, _ := http.NewRequest(http.MethodGet, "http://foo.com/max-age", nil)
+
+	_, err := c.Do(req)
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), c.ttl)
+}
+
+func TestClientDoForwardsRequestID(t *testing.T) {
+	defer gock.Off()
+
+	assert := assert.New(t)
+
+	gock.New("http://foo.com").
+		Get("/request-id").
+		MatchHeader(requestid.Header, "abc123").
+		Reply(http.StatusOK).
+		BodyString("ok")
+
+	req, _ := http.NewRequest(http.MethodGet, "http://foo.com/request-id", nil)
+	req = req.WithContext(requestid.NewContext(req.Context(), "abc123"))
+
+	resp, err := New().SetSkipCache(true).Do(req)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.True(gock.IsDone())
+	assert.Empty(req.Header.Get(requestid.Header), "caller's request should not be modified")
+}
+
+func TestClientDoTracing(t *testing.T) {
+	defer gock.Off()
+
+	assert := assert.New(t)
+	exporter := tracing.NewInMemoryExporter()
+
+	// Setup installs global tracing state, restored for other tests
+	var (
+		tp           = otel.GetTracerProvider()
+		propagator   = otel.GetTextMapPropagator()
+		instrumenter = instrument.Get()
+	)
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagator)
+		instrument.Set(instrumenter)
+	})
+
+	shutdown, err := tracing.Setup(tracing.Options{
+		Exporter:    exporter,
+		Synchronous: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = shutdown(context.Background()) }()
+
+	gock.New("http://foo.com").
+		Get("/traced").
+		MatchHeader("traceparent", "^00-").
+		Reply(http.StatusOK).
+		BodyString("ok")
+
+	req, _ := http.NewRequest(http.MethodGet, "http://foo.com/traced", nil)
+
+	_, err = New().SetSkipCache(true).Do(req)
+	assert.Nil(err)
+	assert.True(gock.IsDone())
+
+	spans := exporter.GetSpans()
+	if assert.Len(spans, 1) {
+		assert.Equal("HTTP GET", spans[0].Name)
+		assert.Equal(trace.SpanKindClient, spans[0].SpanKind)
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/nickhstr/goweb/cache"
+)
+
+// ttlContextKey is used in a context to override the TTL of a request's
+// cached response.
+type ttlContextKey struct{}
+
+// skipCacheContextKey is used in a context to skip caching for a request.
+type skipCacheContextKey struct{}
+
+// cacheKeyContextKey is used in a context to override a request's cache
+// key.
+type cacheKeyContextKey struct{}
+
+// WithTTL returns a copy of parent in which requests' responses are cached
+// for ttl, overriding both the Client's TTL and the responses' freshness.
+// Responses which may not be stored (e.g. "no-store") are still not
+// stored. A ttl of zero or less has no effect.
+func WithTTL(parent context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(parent, ttlContextKey{}, ttl)
+}
+
+// ttlFromContext returns the TTL override stored in ctx, if any.
+func ttlFromContext(ctx context.Context) (time.Duration, bool) {
+	ttl, ok := ctx.Value(ttlContextKey{}).(time.Duration)
+	return ttl, ok && ttl > 0
+}
+
+// WithCacheKey returns a copy of parent in which requests are cached under
+// the given key, in place of the default key made from the request's
+// method and URL. The Client's cache key prefix is still added.
+func WithCacheKey(parent context.Context, key string) context.Context {
+	return context.WithValue(parent, cacheKeyContextKey{}, key)
+}
+
+// cacheKeyFromContext returns the cache key override stored in ctx, if
+// any.
+func cacheKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(cacheKeyContextKey{}).(string)
+	return key, ok && key != ""
+}
+
+// WithForceRefresh returns a copy of parent in which requests bypass
+// cached responses, but still cache their fresh responses.
+// It is equivalent to cache.ContextWithNoCache, which the Client, like
+// mongodb.DB.FindOne, also honors.
+func WithForceRefresh(parent context.Context) context.Context {
+	return cache.ContextWithNoCache(parent)
+}
+
+// WithSkipCache returns a copy of parent in which requests neither use nor
+// store cached responses, as if the Client's skip cache option were set.
+func WithSkipCache(parent context.Context) context.Context {
+	return context.WithValue(parent, skipCacheContextKey{}, true)
+}
+
+// skipCacheFromContext reports whether ctx skips caching.
+func skipCacheFromContext(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipCacheContextKey{}).(bool)
+	return skip
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nickhstr/goweb/cache"
+	"github.com/nickhstr/goweb/internal/cachetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientDoContextCacheControls(t *testing.T) {
+	var hits int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=900")
+		fmt.Fprintf(w, "%d", n)
+	}))
+	defer srv.Close()
+
+	get := func(c *Client, ctx context.Context, path string) string {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		return string(body)
+	}
+
+	t.Run("should force a refresh", func(t *testing.T) {
+		assert := assert.New(t)
+		atomic.StoreInt32(&hits, 0)
+		c := New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+		ctx := context.Background()
+
+		assert.Equal("1", get(c, ctx, "/"))
+		assert.Equal("1", get(c, ctx, "/"))
+		assert.Equal("2", get(c, WithForceRefresh(ctx), "/"))
+		assert.Equal("3", get(c, cache.ContextWithNoCache(ctx), "/"))
+		assert.Equal("3", get(c, ctx, "/"))
+	})
+
+	t.Run("should skip the cache", func(t *testing.T) {
+		assert := assert.New(t)
+		atomic.StoreInt32(&hits, 0)
+		c := New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+		ctx := context.Background()
+
+		assert.Equal("1", get(c, WithSkipCache(ctx), "/"))
+		assert.Equal("2", get(c, ctx, "/"))
+		assert.Equal("3", get(c, WithSkipCache(ctx), "/"))
+		assert.Equal("2", get(c, ctx, "/"))
+	})
+
+	t.Run("should override the cache key", func(t *testing.T) {
+		assert := assert.New(t)
+		atomic.StoreInt32(&hits, 0)
+		c := New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+		ctx := WithCacheKey(context.Background(), "shared")
+
+		assert.Equal("1", get(c, ctx, "/foo"))
+		assert.Equal("1", get(c, ctx, "/bar"))
+		assert.Equal("2", get(c, context.Background(), "/bar"))
+	})
+
+	t.Run("should override the TTL", func(t *testing.T) {
+		assert := assert.New(t)
+		atomic.StoreInt32(&hits, 0)
+		c := New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+		ctx := WithTTL(context.Background(), time.Nanosecond)
+
+		assert.Equal("1", get(c, ctx, "/"))
+		assert.Equal("2", get(c, ctx, "/"))
+		assert.Equal("3", get(c, context.Background(), "/"))
+		assert.Equal("3", get(c, context.Background(), "/"))
+	})
+}
@@ -0,0 +1,326 @@
+package client
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgePolicy configures request hedging: sending a second, identical
+// request when the first is slow, and using whichever response arrives
+// first. The slower request is canceled.
+// Only idempotent requests (see isIdempotent), whose bodies can be replayed,
+// are hedged.
+type HedgePolicy struct {
+	// Enabled turns on hedging.
+	Enabled bool
+
+	// Delay is how long to wait for a response before sending the hedge
+	// request.
+	// Default is: the host's observed latency at Percentile.
+	Delay time.Duration
+
+	// Percentile is the percentile of a host's observed latency used as the
+	// delay, when Delay is not set.
+	// Default is: 0.95.
+	Percentile float64
+
+	// MinSamples is the number of latencies observed for a host before
+	// its requests are hedged, when Delay is not set.
+	// Default is: 20.
+	MinSamples int
+
+	// MaxRate caps hedge requests to this fraction of a host's requests,
+	// so that hedging cannot amplify load on a struggling upstream.
+	// Default is: 0.1.
+	MaxRate float64
+}
+
+// withDefaults returns a copy of the policy with defaults applied.
+func (p HedgePolicy) withDefaults() HedgePolicy {
+	if p.Percentile == 0 {
+		p.Percentile = 0.95
+	}
+
+	if p.MinSamples == 0 {
+		p.MinSamples = 20
+	}
+
+	if p.MaxRate == 0 {
+		p.MaxRate = 0.1
+	}
+
+	return p
+}
+
+// latencySamples is the number of recent latencies kept per host.
+const latencySamples = 128
+
+// hedger tracks a single host's latencies and hedging budget.
+type hedger struct {
+	mu     sync.Mutex
+	policy HedgePolicy
+
+	latencies []time.Duration
+	next      int
+
+	// budget is the number of hedge requests which may be sent. Every
+	// request earns MaxRate of a hedge, up to maxHedgeBudget.
+	budget float64
+}
+
+// maxHedgeBudget caps the hedges saved up while requests are fast, so
+// that a sudden slowdown is not met with a burst of hedge requests.
+const maxHedgeBudget = 10
+
+// delay returns how long to wait before hedging, and false if the request
+// should not be hedged.
+func (h *hedger) delay() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.budget = math.Min(h.budget+h.policy.MaxRate, maxHedgeBudget)
+
+	if h.policy.Delay > 0 {
+		return h.policy.Delay, true
+	}
+
+	if len(h.latencies) < h.policy.MinSamples || len(h.latencies) == 0 {
+		return 0, false
+	}
+
+	sorted := make([]time.Duration, len(h.latencies))
+	copy(sorted, h.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(math.Ceil(h.policy.Percentile*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i], true
+}
+
+// allow reports whether a hedge request may be sent, spending from the
+// budget if so.
+func (h *hedger) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.budget < 1 {
+		return false
+	}
+
+	h.budget--
+
+	return true
+}
+
+// observe records a request's latency.
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.latencies) < latencySamples {
+		h.latencies = append(h.latencies, d)
+		return
+	}
+
+	h.latencies[h.next] = d
+	h.next = (h.next + 1) % latencySamples
+}
+
+// hedgers holds a hedger per host.
+type hedgers struct {
+	mu     sync.Mutex
+	policy HedgePolicy
+	hosts  map[string]*hedger
+}
+
+func newHedgers(p HedgePolicy) *hedgers {
+	return &hedgers{
+		policy: p.withDefaults(),
+		hosts:  make(map[string]*hedger),
+	}
+}
+
+func (hs *hedgers) get(host string) *hedger {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	h, ok := hs.hosts[host]
+	if !ok {
+		h = &hedger{policy: hs.policy}
+		hs.hosts[host] = h
+	}
+
+	return h
+}
+
+// hedgeResult is the outcome of one of a hedged request's attempts.
+type hedgeResult struct {
+	resp    *http.Response
+	err     error
+	latency time.Duration
+	hedge   bool
+	cancel  context.CancelFunc
+}
+
+// cancelOnClose cancels a request's context once its response body is
+// closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
+
+// hedgedDo does the request, hedging it according to the Client's
+// HedgePolicy.
+func (c *Client) hedgedDo(req *http.Request) (*http.Response, error) {
+	if c.hedgers == nil || !isIdempotent(req) || !canReplay(req) {
+		return c.doAttempt(req)
+	}
+
+	h := c.hedgers.get(req.URL.Host)
+
+	delay, ok := h.delay()
+	if !ok {
+		start := time.Now()
+		resp, err := c.doAttempt(req)
+
+		if err == nil {
+			h.observe(time.Since(start))
+		}
+
+		return resp, err
+	}
+
+	var (
+		results = make(chan hedgeResult, 2)
+		// cancels holds the primary attempt's, then any hedge's, cancel
+		cancels []context.CancelFunc
+	)
+
+	bh := c.bulkheads.get(req.URL.Host)
+
+	// the primary attempt waits for a slot, which a hedge only takes if
+	// one is free
+	if err := bh.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+
+	launch := func(r *http.Request, hedge bool) {
+		ctx, cancel := context.WithCancel(req.Context())
+		r = r.WithContext(ctx)
+		cancels = append(cancels, cancel)
+
+		go func() {
+			start := time.Now()
+			resp, err := c.doAcquired(bh, r)
+			results <- hedgeResult{resp, err, time.Since(start), hedge, cancel}
+		}()
+	}
+
+	launch(req, false)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	inFlight := 1
+
+	for {
+		select {
+		case <-timer.C:
+			if !bh.tryAcquire() {
+				continue
+			}
+
+			if !h.allow() {
+				bh.release(outcomeIgnored, nil, 0)
+				continue
+			}
+
+			hedge, err := hedgeRequest(req)
+			if err != nil {
+				bh.release(outcomeIgnored, nil, 0)
+				continue
+			}
+
+			hedgeRequests.WithLabelValues(req.URL.Host, c.endpointLabel(req)).Inc()
+			launch(hedge, true)
+			inFlight++
+
+		case res := <-results:
+			inFlight--
+
+			// wait for the other attempt, if this one failed
+			if res.err != nil && inFlight > 0 {
+				res.cancel()
+				continue
+			}
+
+			if res.err != nil {
+				res.cancel()
+				return nil, res.err
+			}
+
+			h.observe(res.latency)
+
+			if res.hedge {
+				hedgeWins.WithLabelValues(req.URL.Host, c.endpointLabel(req)).Inc()
+			}
+
+			if inFlight > 0 {
+				loser := cancels[1]
+				if res.hedge {
+					loser = cancels[0]
+				}
+
+				loser()
+
+				go discardLoser(results)
+			}
+
+			res.resp.Body = &cancelOnClose{res.resp.Body, res.cancel}
+
+			return res.resp, nil
+		}
+	}
+}
+
+// hedgeRequest returns a copy of the request, with a fresh body, to send as
+// a hedge.
+func hedgeRequest(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		r.Body = body
+	}
+
+	return r, nil
+}
+
+// discardLoser waits for the canceled, losing attempt of a hedged request,
+// and discards its response.
+func discardLoser(results <-chan hedgeResult) {
+	res := <-results
+
+	if res.resp != nil {
+		discard(res.resp)
+	}
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedgerDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    HedgePolicy
+		latencies int
+		expected  time.Duration
+		ok        bool
+	}{
+		{
+			"should use fixed delay",
+			HedgePolicy{Delay: time.Second},
+			0,
+			time.Second,
+			true,
+		},
+		{
+			"should wait for enough samples",
+			HedgePolicy{},
+			19,
+			0,
+			false,
+		},
+		{
+			"should use observed p95",
+			HedgePolicy{},
+			100,
+			95 * time.Millisecond,
+			true,
+		},
+		{
+			"should use observed percentile",
+			HedgePolicy{Percentile: 0.5},
+			100,
+			50 * time.Millisecond,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			h := &hedger{policy: test.policy.withDefaults()}
+
+			for i := test.latencies; i > 0; i-- {
+				h.observe(time.Duration(i) * time.Millisecond)
+			}
+
+			delay, ok := h.delay()
+			assert.Equal(test.ok, ok)
+			assert.Equal(test.expected, delay)
+		})
+	}
+}
+
+func TestHedgerBudget(t *testing.T) {
+	assert := assert.New(t)
+	h := &hedger{policy: HedgePolicy{Delay: time.Second, MaxRate: 0.25}.withDefaults()}
+
+	var hedges int
+
+	for i := 0; i < 100; i++ {
+		_, _ = h.delay()
+
+		if h.allow() {
+			hedges++
+		}
+	}
+
+	assert.Equal(25, hedges)
+}
+
+func TestClientDoHedging(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		requests int32
+		canceled = make(chan struct{})
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request hangs until canceled
+		if atomic.AddInt32(&requests, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				close(canceled)
+			case <-time.After(5 * time.Second):
+			}
+
+			return
+		}
+
+		w.Write([]byte("hedged"))
+	}))
+	defer srv.Close()
+
+	c := New().
+		SetHTTPClient(srv.Client()).
+		SetSkipCache(true).
+		SetHedgePolicy(HedgePolicy{
+			Enabled: true,
+			Delay:   10 * time.Millisecond,
+			MaxRate: 1,
+		})
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(req)
+
+	if assert.Nil(err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal("hedged", string(body))
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("expected the slow request to be canceled")
+	}
+
+	assert.Equal(int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestClientDoHedgingSkipsNonIdempotent(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := New().
+		SetHTTPClient(srv.Client()).
+		SetHedgePolicy(HedgePolicy{
+			Enabled: true,
+			Delay:   time.Millisecond,
+			MaxRate: 1,
+		})
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("foo"))
+	_, err := c.Do(req)
+
+	assert.Nil(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/nickhstr/goweb/requestid"
+)
+
+// Interceptor wraps an http.RoundTripper, to act on outgoing requests and
+// their responses, the way middleware.Middleware wraps an http.Handler.
+// Interceptors must not modify the request they are given; they should
+// modify a clone instead, as required of any http.RoundTripper.
+type Interceptor = func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to an http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain adds interceptors to a given RoundTripper.
+// Interceptors are ordered from first to last; the first sees requests
+// first, and responses last.
+func Chain(rt http.RoundTripper, i ...Interceptor) http.RoundTripper {
+	for j := len(i) - 1; j >= 0; j-- {
+		rt = i[j](rt)
+	}
+
+	return rt
+}
+
+// withHeader returns a clone of the request with the header set.
+func withHeader(req *http.Request, key, value string) *http.Request {
+	r := req.Clone(req.Context())
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+
+	r.Header.Set(key, value)
+
+	return r
+}
+
+// sensitiveHeaders are the headers http.Client does not forward when
+// following a redirect to another host.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":    true,
+	"Cookie":           true,
+	"Cookie2":          true,
+	"Www-Authenticate": true,
+}
+
+// redirectedAway reports whether the request follows a redirect from the
+// host of the original request to a host which is neither it nor one of
+// its subdomains, to which, like http.Client, interceptors must not send
+// credentials.
+func redirectedAway(req *http.Request) bool {
+	orig := req
+	for orig.Response != nil && orig.Response.Request != nil {
+		orig = orig.Response.Request
+	}
+
+	// the original request is unknown
+	if orig.Response != nil {
+		return true
+	}
+
+	from := strings.ToLower(orig.URL.Hostname())
+	to := strings.ToLower(req.URL.Hostname())
+
+	if to == from {
+		return false
+	}
+
+	// IPv6 addresses have no subdomains
+	if strings.ContainsAny(to, ":%") {
+		return true
+	}
+
+	return !strings.HasSuffix(to, "."+from)
+}
+
+// DefaultHeaders sets the given headers on requests which do not already
+// have them. Credentials, e.g. an Authorization header, are not sent to
+// other hosts requests are redirected to.
+func DefaultHeaders(h http.Header) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			var r *http.Request
+
+			away := redirectedAway(req)
+
+			for key, values := range h {
+				if req.Header.Get(key) != "" || away && sensitiveHeaders[http.CanonicalHeaderKey(key)] {
+					continue
+				}
+
+				if r == nil {
+					r = req.Clone(req.Context())
+					if r.Header == nil {
+						r.Header = make(http.Header)
+					}
+				}
+
+				r.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+			}
+
+			if r == nil {
+				r = req
+			}
+
+			return next.RoundTrip(r)
+		})
+	}
+}
+
+// UserAgent sets the User-Agent header on requests which do not already
+// have one.
+func UserAgent(ua string) Interceptor {
+	return DefaultHeaders(http.Header{"User-Agent": []string{ua}})
+}
+
+// RequestID sets the X-Request-ID header from the request's context, so
+// that request IDs propagate to upstream services. Requests which already
+// have the header are left as they are.
+// Clients created with New use this interceptor.
+func RequestID(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		id, ok := requestid.FromContext(req.Context())
+		if !ok || req.Header.Get(requestid.Header) != "" {
+			return next.RoundTrip(req)
+		}
+
+		return next.RoundTrip(withHeader(req, requestid.Header, id))
+	})
+}
+
+// BearerToken sets the Authorization header to the given bearer token,
+// on requests which do not already have the header, except those
+// redirected to other hosts.
+func BearerToken(token string) Interceptor {
+	return BearerTokenFunc(func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// BearerTokenFunc sets the Authorization header to a bearer token from the
+// given function, on requests which do not already have the header, except
+// those redirected to other hosts.
+// The function is called for every request, so it may refresh the token
+// as needed; it should cache the token otherwise. If it errors, the
+// request fails with its error.
+func BearerTokenFunc(token func(context.Context) (string, error)) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "" || redirectedAway(req) {
+				return next.RoundTrip(req)
+			}
+
+			t, err := token(req.Context())
+			if err != nil {
+				return nil, err
+			}
+
+			return next.RoundTrip(withHeader(req, "Authorization", "Bearer "+t))
+		})
+	}
+}
+
+// transport returns the base RoundTripper of an http.Client.
+func transport(hc *http.Client) http.RoundTripper {
+	if hc.Transport != nil {
+		return hc.Transport
+	}
+
+	// look up DefaultTransport per request, as http.Client does, in case
+	// it is replaced
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return http.DefaultTransport.RoundTrip(req)
+	})
+}
+
+// buildHTTPClient rebuilds the http.Client used to send requests, from the
+// Client's http.Client with its interceptors chained around its transport.
+// The http.Client given to SetHTTPClient is never modified.
+func (c *Client) buildHTTPClient() {
+	if len(c.interceptors) == 0 {
+		c.chainedClient = c.httpClient
+		return
+	}
+
+	hc := *c.httpClient
+	hc.Transport = Chain(transport(c.httpClient), c.interceptors...)
+	c.chainedClient = &hc
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echoHeaders returns a RoundTripper which responds with the request's
+// headers.
+func echoHeaders() http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: req.Header.Clone()}, nil
+	})
+}
+
+func TestChain(t *testing.T) {
+	assert := assert.New(t)
+
+	var order []string
+
+	record := func(name string) Interceptor {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://foo.com", nil)
+	_, err := Chain(echoHeaders(), record("first"), record("second")).RoundTrip(req)
+
+	assert.Nil(err)
+	assert.Equal([]string{"first", "second"}, order)
+}
+
+func TestInterceptors(t *testing.T) {
+	tests := []struct {
+		name        string
+		interceptor Interceptor
+		header      http.Header
+		expected    http.Header
+	}{
+		{
+			"should set default headers",
+			DefaultHeaders(http.Header{"Accept": []string{"application/json"}}),
+			http.Header{},
+			http.Header{"Accept": []string{"application/json"}},
+		},
+		{
+			"should not override headers",
+			DefaultHeaders(http.Header{"Accept": []string{"application/json"}}),
+			http.Header{"Accept": []string{"text/plain"}},
+			http.Header{"Accept": []string{"text/plain"}},
+		},
+		{
+			"should set user-agent",
+			UserAgent("goweb"),
+			http.Header{},
+			http.Header{"User-Agent": []string{"goweb"}},
+		},
+		{
+			"should set bearer token",
+			BearerToken("abc123"),
+			http.Header{},
+			http.Header{"Authorization": []string{"Bearer abc123"}},
+		},
+		{
+			"should not override authorization",
+			BearerToken("abc123"),
+			http.Header{"Authorization": []string{"Basic Zm9vOmJhcg=="}},
+			http.Header{"Authorization": []string{"Basic Zm9vOmJhcg=="}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			req, _ := http.NewRequest(http.MethodGet, "http://foo.com", nil)
+			req.Header = test.header.Clone()
+
+			resp, err := test.interceptor(echoHeaders()).RoundTrip(req)
+
+			if assert.Nil(err) {
+				assert.Equal(test.expected, resp.Header)
+			}
+
+			// the original request must not be modified
+			assert.Equal(test.header, req.Header)
+		})
+	}
+}
+
+func TestBearerTokenFuncError(t *testing.T) {
+	assert := assert.New(t)
+	tokenErr := errors.New("no token")
+
+	rt := BearerTokenFunc(func(context.Context) (string, error) {
+		return "", tokenErr
+	})(echoHeaders())
+
+	req, _ := http.NewRequest(http.MethodGet, "http://foo.com", nil)
+	_, err := rt.RoundTrip(req)
+
+	assert.Equal(tokenErr, err)
+}
+
+func TestClientUse(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization") + "|" + r.Header.Get("User-Agent")))
+	}))
+	defer srv.Close()
+
+	hc := srv.Client()
+	transport := hc.Transport
+
+	c := New().
+		SetSkipCache(true).
+		Use(BearerToken("abc123")).
+		SetHTTPClient(hc).
+		Use(UserAgent("goweb"))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(req)
+
+	if assert.Nil(err) {
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal("Bearer abc123|goweb", string(body))
+	}
+
+	assert.Equal(transport, hc.Transport)
+}
+
+func TestInterceptorsRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		expected string
+	}{
+		{
+			"should send credentials to the same host",
+			"127.0.0.1",
+			"Bearer abc123|secret|goweb",
+		},
+		{
+			"should not send credentials to other hosts",
+			"localhost",
+			"||goweb",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Header.Get("Authorization") + "|" + r.Header.Get("Cookie") + "|" + r.Header.Get("User-Agent")))
+			}))
+			defer target.Close()
+
+			_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "http://"+net.JoinHostPort(test.host, port), http.StatusFound)
+			}))
+			defer srv.Close()
+
+			c := New().
+				SetSkipCache(true).
+				Use(
+					BearerToken("abc123"),
+					DefaultHeaders(http.Header{"Cookie": []string{"secret"}}),
+					UserAgent("goweb"),
+				)
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			resp, err := c.Do(req)
+
+			if assert.Nil(err) {
+				defer resp.Body.Close()
+
+				body, _ := ioutil.ReadAll(resp.Body)
+				assert.Equal(test.expected, string(body))
+			}
+		})
+	}
+}
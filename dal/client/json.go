@@ -0,0 +1,158 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// MaxErrorBodySize is the number of bytes of a response body kept in a
+// StatusError.
+const MaxErrorBodySize = 1024
+
+// ErrResponseTooLarge is returned when a response body exceeds the
+// Client's maximum response size.
+var ErrResponseTooLarge = errors.New("client: response body too large")
+
+// StatusError is returned by the JSON helper methods for responses with a
+// non-2xx status code.
+type StatusError struct {
+	// Method is the request's method.
+	Method string
+	// URL is the request's URL.
+	URL string
+	// StatusCode is the response's status code.
+	StatusCode int
+	// Body is the start of the response body, truncated to
+	// MaxErrorBodySize.
+	Body []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("client: %s %s: unexpected status %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// GetJSON sends a GET request to the URL, and decodes the JSON response
+// into out.
+func (c *Client) GetJSON(ctx context.Context, url string, out interface{}) error {
+	return c.DoJSON(ctx, http.MethodGet, url, nil, out)
+}
+
+// PostJSON sends a POST request to the URL with in encoded as JSON, and
+// decodes the JSON response into out.
+func (c *Client) PostJSON(ctx context.Context, url string, in, out interface{}) error {
+	return c.DoJSON(ctx, http.MethodPost, url, in, out)
+}
+
+// PutJSON sends a PUT request to the URL with in encoded as JSON, and
+// decodes the JSON response into out.
+func (c *Client) PutJSON(ctx context.Context, url string, in, out interface{}) error {
+	return c.DoJSON(ctx, http.MethodPut, url, in, out)
+}
+
+// DeleteJSON sends a DELETE request to the URL, and decodes the JSON
+// response into out.
+func (c *Client) DeleteJSON(ctx context.Context, url string, out interface{}) error {
+	return c.DoJSON(ctx, http.MethodDelete, url, nil, out)
+}
+
+// DoJSON sends a request with in, if not nil, encoded as JSON, and decodes
+// the JSON response into out, if not nil.
+// A *StatusError is returned for responses with a non-2xx status code.
+// The response body is always drained and closed.
+func (c *Client) DoJSON(ctx context.Context, method, url string, in, out interface{}) error {
+	var body io.Reader
+
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer discard(resp)
+
+	r := c.LimitBody(resp.Body)
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		data, _ := ioutil.ReadAll(io.LimitReader(r, MaxErrorBodySize))
+
+		return &StatusError{
+			Method:     method,
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Body:       data,
+		}
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.NewDecoder(r).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+// LimitBody limits a response body to the Client's maximum response size,
+// if set, for packages built on the Client which read bodies themselves.
+// Reads fail with ErrResponseTooLarge past the limit.
+func (c *Client) LimitBody(body io.Reader) io.Reader {
+	if c.maxResponseSize <= 0 {
+		return body
+	}
+
+	return &limitedReader{body, c.maxResponseSize}
+}
+
+// limitedReader reads from r, returning ErrResponseTooLarge once more than
+// n bytes have been read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrResponseTooLarge
+	}
+
+	// read one byte more than allowed, to detect bodies which are too large
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+
+	if l.n < 0 {
+		return n + int(l.n), ErrResponseTooLarge
+	}
+
+	return n, err
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nickhstr/goweb/internal/cachetest"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestClientDoJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/1":
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":1,"name":"foo"}`))
+		case "/users":
+			var u user
+			if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&u) != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			u.ID = 2
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(u)
+		case "/large":
+			if r.URL.Query().Get("cache") != "" {
+				w.Header().Set("Cache-Control", "max-age=60")
+			}
+
+			w.Write([]byte(`{"name":"` + strings.Repeat("a", 100) + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(strings.Repeat("x", 2*MaxErrorBodySize)))
+		}
+	}))
+	defer srv.Close()
+
+	c := New().SetHTTPClient(srv.Client()).SetSkipCache(true)
+	ctx := context.Background()
+
+	t.Run("should decode GET response", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var u user
+		err := c.GetJSON(ctx, srv.URL+"/users/1", &u)
+
+		assert.Nil(err)
+		assert.Equal(user{1, "foo"}, u)
+	})
+
+	t.Run("should encode POST request", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var u user
+		err := c.PostJSON(ctx, srv.URL+"/users", user{Name: "bar"}, &u)
+
+		assert.Nil(err)
+		assert.Equal(user{2, "bar"}, u)
+	})
+
+	t.Run("should allow no content", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var u user
+		err := c.DeleteJSON(ctx, srv.URL+"/users/1", &u)
+
+		assert.Nil(err)
+		assert.Equal(user{}, u)
+	})
+
+	t.Run("should return a status error", func(t *testing.T) {
+		assert := assert.New(t)
+
+		err := c.PutJSON(ctx, srv.URL+"/missing", user{}, nil)
+
+		var statusErr *StatusError
+		if assert.True(errors.As(err, &statusErr)) {
+			assert.Equal(http.StatusNotFound, statusErr.StatusCode)
+			assert.Equal(http.MethodPut, statusErr.Method)
+			assert.Len(statusErr.Body, MaxErrorBodySize)
+		}
+	})
+
+	t.Run("should limit response size", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var u user
+		err := New().
+			SetHTTPClient(srv.Client()).
+			SetSkipCache(true).
+			SetMaxResponseSize(50).
+			GetJSON(ctx, srv.URL+"/large", &u)
+
+		assert.True(errors.Is(err, ErrResponseTooLarge))
+	})
+
+	t.Run("should not cache responses over the size limit", func(t *testing.T) {
+		assert := assert.New(t)
+		cacher := cachetest.NewMemory()
+		c := New().
+			SetHTTPClient(srv.Client()).
+			SetCacher(cacher).
+			SetMaxResponseSize(50)
+
+		var u user
+		err := c.GetJSON(ctx, srv.URL+"/large?cache=1", &u)
+		assert.True(errors.Is(err, ErrResponseTooLarge))
+		assert.Zero(cacher.Len())
+
+		// the whole body is still readable with Do
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/large?cache=1", nil)
+		resp, err := c.Do(req)
+
+		if assert.Nil(err) {
+			defer resp.Body.Close()
+
+			body, _ := ioutil.ReadAll(resp.Body)
+			assert.Len(body, 111)
+		}
+
+		assert.Zero(cacher.Len())
+	})
+}
+
+func TestLimitedReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		limit    int64
+		expected error
+	}{
+		{
+			"should read bodies within the limit",
+			"foo",
+			3,
+			nil,
+		},
+		{
+			"should fail bodies over the limit",
+			"foobar",
+			3,
+			ErrResponseTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			buf := make([]byte, 0, 16)
+			r := &limitedReader{strings.NewReader(test.data), test.limit}
+
+			var err error
+
+			for err == nil {
+				p := make([]byte, 2)
+
+				var n int
+				n, err = r.Read(p)
+				buf = append(buf, p[:n]...)
+			}
+
+			if test.expected == nil {
+				assert.Equal(test.data, string(buf))
+			} else {
+				assert.Equal(test.expected, err)
+				assert.LessOrEqual(len(buf), int(test.limit))
+			}
+		})
+	}
+}
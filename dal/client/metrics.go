@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestLabels = []string{"host", "endpoint", "method", "status", "cache"}
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dal_requests_total",
+		Help: "Total number of outgoing DAL requests.",
+	}, requestLabels)
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dal_request_duration_seconds",
+		Help:    "Duration of outgoing DAL requests, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, requestLabels)
+
+	requestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dal_request_errors_total",
+		Help: "Total number of outgoing DAL requests which failed without a response.",
+	}, []string{"host", "endpoint", "method", "reason"})
+
+	requestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dal_requests_in_flight",
+		Help: "Number of outgoing DAL requests currently in flight.",
+	}, []string{"host"})
+
+	concurrencyLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dal_concurrency_limit",
+		Help: "Current limit of concurrent outgoing DAL requests, for hosts with a bulkhead, as last adapted by any client.",
+	}, []string{"host"})
+
+	hedgeRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dal_hedge_requests_total",
+		Help: "Total number of hedge requests sent for slow DAL requests.",
+	}, []string{"host", "endpoint"})
+
+	hedgeWins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dal_hedge_wins_total",
+		Help: "Total number of hedge requests which responded before the original request.",
+	}, []string{"host", "endpoint"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		requestsTotal,
+		requestDuration,
+		requestErrors,
+		requestsInFlight,
+		concurrencyLimit,
+		hedgeRequests,
+		hedgeWins,
+	)
+}
+
+// Reasons for failed requests, used as the "reason" label.
+const (
+	reasonCircuitOpen = "circuit_open"
+	reasonOverloaded  = "overloaded"
+	reasonTimeout     = "timeout"
+	reasonTransport   = "transport"
+)
+
+// Cache usage, used as the "cache" label.
+const (
+	cacheHit         = "hit"
+	cacheMiss        = "miss"
+	cacheRevalidated = "revalidated"
+	cacheStale       = "stale"
+)
+
+// EndpointLabeler returns the endpoint label for a request's metrics.
+// It should return a low-cardinality name (e.g. "get-user"), never the full
+// URL.
+type EndpointLabeler func(*http.Request) string
+
+// endpointLabel returns the endpoint label for the request, or an empty
+// string if the Client has no EndpointLabeler.
+func (c *Client) endpointLabel(req *http.Request) string {
+	if c.endpointLabeler == nil {
+		return ""
+	}
+
+	return c.endpointLabeler(req)
+}
+
+// observeResponse records metrics for a request which received a response,
+// whether from the upstream or the cache.
+func (c *Client) observeResponse(req *http.Request, status int, cacheLabel string, start time.Time) {
+	labels := prometheus.Labels{
+		"host":     req.URL.Host,
+		"endpoint": c.endpointLabel(req),
+		"method":   req.Method,
+		"status":   strconv.Itoa(status),
+		"cache":    cacheLabel,
+	}
+
+	requestsTotal.With(labels).Inc()
+	requestDuration.With(labels).Observe(time.Since(start).Seconds())
+}
+
+// observeError records metrics for a request which failed without a
+// response.
+func (c *Client) observeError(req *http.Request, err error) {
+	requestErrors.With(prometheus.Labels{
+		"host":     req.URL.Host,
+		"endpoint": c.endpointLabel(req),
+		"method":   req.Method,
+		"reason":   errorReason(err),
+	}).Inc()
+}
+
+// errorReason classifies a request error as a rejection by a circuit
+// breaker or bulkhead, a timeout, or a transport error.
+func errorReason(err error) string {
+	if errors.Is(err, ErrCircuitOpen) {
+		return reasonCircuitOpen
+	}
+
+	if errors.Is(err, ErrOverloaded) {
+		return reasonOverloaded
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return reasonTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return reasonTimeout
+	}
+
+	return reasonTransport
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestClientDoMetrics(t *testing.T) {
+	defer gock.Off()
+
+	assert := assert.New(t)
+
+	gock.New("http://metrics.com").
+		Get("/users/1").
+		Reply(http.StatusNotFound)
+	gock.New("http://metrics.com").
+		Get("/users/2").
+		ReplyError(errors.New("connection refused"))
+
+	c := New().
+		SetSkipCache(true).
+		SetEndpointLabeler(func(*http.Request) string { return "get-user" })
+
+	// the collectors are global, so only their changes are asserted
+	responses := requestsTotal.With(prometheus.Labels{
+		"host":     "metrics.com",
+		"endpoint": "get-user",
+		"method":   http.MethodGet,
+		"status":   "404",
+		"cache":    "miss",
+	})
+	errs := requestErrors.With(prometheus.Labels{
+		"host":     "metrics.com",
+		"endpoint": "get-user",
+		"method":   http.MethodGet,
+		"reason":   reasonTransport,
+	})
+	responsesBefore := testutil.ToFloat64(responses)
+	errsBefore := testutil.ToFloat64(errs)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://metrics.com/users/1", nil)
+	_, err := c.Do(req)
+	assert.Nil(err)
+
+	req, _ = http.NewRequest(http.MethodGet, "http://metrics.com/users/2", nil)
+	_, err = c.Do(req)
+	assert.NotNil(err)
+
+	assert.Equal(1.0, testutil.ToFloat64(responses)-responsesBefore)
+	assert.Equal(1.0, testutil.ToFloat64(errs)-errsBefore)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func Test_errorReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			"context deadline should be a timeout",
+			fmt.Errorf("request failed: %w", context.DeadlineExceeded),
+			reasonTimeout,
+		},
+		{
+			"net timeout should be a timeout",
+			timeoutError{},
+			reasonTimeout,
+		},
+		{
+			"other errors should be transport errors",
+			errors.New("connection refused"),
+			reasonTransport,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, errorReason(test.err))
+		})
+	}
+}
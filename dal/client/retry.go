@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how a Client retries failed requests.
+// Only idempotent requests (see isIdempotent), whose bodies can be replayed,
+// are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Zero or one disables retries.
+	MaxAttempts int
+
+	// BaseDelay is the backoff delay before the first retry; delays double
+	// with each retry.
+	// Default is: 100 milliseconds.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff delay between attempts. Responses whose
+	// Retry-After header asks for a longer delay are not retried.
+	// Default is: 5 seconds.
+	MaxDelay time.Duration
+
+	// MaxElapsed is the total time budget for all attempts. No retry is
+	// made if its delay would exceed the budget. The request's context
+	// deadline is always respected.
+	// Default is: no budget besides the context's.
+	MaxElapsed time.Duration
+
+	// RetryStatuses are the response status codes which are retried.
+	// Default is: 429, 502, 503, 504.
+	RetryStatuses []int
+}
+
+var defaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// withDefaults returns a copy of the policy with defaults applied.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.BaseDelay == 0 {
+		p.BaseDelay = 100 * time.Millisecond
+	}
+
+	if p.MaxDelay == 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+
+	if len(p.RetryStatuses) == 0 {
+		p.RetryStatuses = defaultRetryStatuses
+	}
+
+	return p
+}
+
+func (p RetryPolicy) retryStatus(status int) bool {
+	for _, s := range p.RetryStatuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns a random delay between zero and the exponential backoff
+// ceiling for the given retry ("full jitter").
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.MaxDelay
+
+	// guard against overflow for large retry counts
+	if retry < 32 {
+		if d := p.BaseDelay << uint(retry); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// isIdempotent reports whether the request can safely be sent more than
+// once, following the same rules as net/http: idempotent methods, or any
+// request with an Idempotency-Key header.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	_, hasKey := req.Header["Idempotency-Key"]
+
+	return hasKey
+}
+
+// canReplay reports whether the request's body can be sent again.
+func canReplay(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retryAfter parses a response's Retry-After header, given either in
+// seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	val := resp.Header.Get("Retry-After")
+	if val == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(val); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(val); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+
+		return d, true
+	}
+
+	return 0, false
+}
+
+// send does the request, retrying according to the Client's RetryPolicy.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	policy := c.retryPolicy
+	if policy.MaxAttempts <= 1 || !isIdempotent(req) || !canReplay(req) {
+		return c.hedgedDo(req)
+	}
+
+	policy = policy.withDefaults()
+	ctx := req.Context()
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req.Body = body
+		}
+
+		resp, err := c.hedgedDo(req)
+
+		// the host's bulkhead is full, which retrying would only add to
+		if errors.Is(err, ErrOverloaded) {
+			return resp, err
+		}
+
+		retryable := err != nil || policy.retryStatus(resp.StatusCode)
+		if !retryable || attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay, ok := retryAfter(resp)
+		if !ok {
+			delay = policy.backoff(attempt - 1)
+		} else if delay > policy.MaxDelay {
+			return resp, err
+		}
+
+		if policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed {
+			return resp, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		l := log.Warn().
+			Str("url", req.URL.String()).
+			Str("method", req.Method).
+			Int("attempt", attempt).
+			Dur("delay", delay)
+
+		if err != nil {
+			l = l.Err(err)
+		} else {
+			l = l.Int("status", resp.StatusCode)
+			discard(resp)
+		}
+
+		l.Msg("Retrying DAL request")
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// maxDrainSize is the number of bytes of a response body discard drains.
+const maxDrainSize = 4 << 10
+
+// discard drains and closes a response body, so its connection can be
+// reused. Bodies larger than maxDrainSize are not drained in full, as
+// reading them costs more than a new connection.
+func discard(resp *http.Response) {
+	_, _ = io.CopyN(ioutil.Discard, resp.Body, maxDrainSize)
+	resp.Body.Close()
+}
+
+// sleep waits for the duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
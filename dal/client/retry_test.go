@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientDoRetry(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		body             string
+		policy           RetryPolicy
+		statuses         []int
+		retryAfter       string
+		expectedStatus   int
+		expectedAttempts int32
+	}{
+		{
+			"GET should be retried until it succeeds",
+			http.MethodGet,
+			"",
+			RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			[]int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			"",
+			http.StatusOK,
+			3,
+		},
+		{
+			"retries should stop after max attempts",
+			http.MethodGet,
+			"",
+			RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+			[]int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			"",
+			http.StatusServiceUnavailable,
+			2,
+		},
+		{
+			"PUT body should be replayed",
+			http.MethodPut,
+			"payload",
+			RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+			[]int{http.StatusGatewayTimeout, http.StatusOK},
+			"",
+			http.StatusOK,
+			2,
+		},
+		{
+			"POST should not be retried",
+			http.MethodPost,
+			"payload",
+			RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			[]int{http.StatusServiceUnavailable, http.StatusOK},
+			"",
+			http.StatusServiceUnavailable,
+			1,
+		},
+		{
+			"non-retryable status should not be retried",
+			http.MethodGet,
+			"",
+			RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			[]int{http.StatusInternalServerError, http.StatusOK},
+			"",
+			http.StatusInternalServerError,
+			1,
+		},
+		{
+			"Retry-After beyond the budget should stop retries",
+			http.MethodGet,
+			"",
+			RetryPolicy{MaxAttempts: 3, MaxElapsed: time.Second},
+			[]int{http.StatusTooManyRequests, http.StatusOK},
+			"10",
+			http.StatusTooManyRequests,
+			1,
+		},
+		{
+			"Retry-After beyond the maximum delay should stop retries",
+			http.MethodGet,
+			"",
+			RetryPolicy{MaxAttempts: 3},
+			[]int{http.StatusServiceUnavailable, http.StatusOK},
+			"86400",
+			http.StatusServiceUnavailable,
+			1,
+		},
+		{
+			"Retry-After within the budget should be honored",
+			http.MethodGet,
+			"",
+			RetryPolicy{MaxAttempts: 3, MaxElapsed: time.Second},
+			[]int{http.StatusTooManyRequests, http.StatusOK},
+			"0",
+			http.StatusOK,
+			2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var attempts int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				body, _ := ioutil.ReadAll(r.Body)
+				assert.Equal(test.body, string(body))
+
+				if test.retryAfter != "" {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+
+				w.WriteHeader(test.statuses[n-1])
+			}))
+			defer srv.Close()
+
+			c := New().
+				SetHTTPClient(srv.Client()).
+				SetSkipCache(true).
+				SetRetryPolicy(test.policy)
+
+			req, _ := http.NewRequest(test.method, srv.URL, strings.NewReader(test.body))
+			resp, err := c.Do(req)
+
+			assert.Nil(err)
+			assert.Equal(test.expectedStatus, resp.StatusCode)
+			assert.Equal(test.expectedAttempts, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func TestClientDoRetryContext(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := New().
+		SetHTTPClient(srv.Client()).
+		SetSkipCache(true).
+		SetRetryPolicy(RetryPolicy{MaxAttempts: 100, BaseDelay: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	start := time.Now()
+	_, _ = c.Do(req)
+
+	assert.Less(int64(time.Since(start)), int64(time.Second))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	assert := assert.New(t)
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+	for retry := 0; retry < 100; retry++ {
+		d := p.backoff(retry)
+		assert.True(d >= 0)
+		assert.True(d <= 50*time.Millisecond)
+	}
+
+	for i := 0; i < 100; i++ {
+		assert.True(p.backoff(0) <= 10*time.Millisecond)
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"seconds should be parsed", "120", 120 * time.Second, true},
+		{"past dates should be zero", "Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+		{"missing header should not be ok", "", 0, false},
+		{"invalid header should not be ok", "soon", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			resp := &http.Response{Header: http.Header{}}
+
+			if test.value != "" {
+				resp.Header.Set("Retry-After", test.value)
+			}
+
+			d, ok := retryAfter(resp)
+			assert.Equal(test.ok, ok)
+			assert.Equal(test.expected, d)
+		})
+	}
+}
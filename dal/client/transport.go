@@ -0,0 +1,286 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nickhstr/goweb/dnscache"
+	"github.com/spf13/viper"
+)
+
+// Options configure the http.Client, and its transport, of a Client
+// created with NewWithOptions.
+type Options struct {
+	// Timeout is the time limit for requests, including reading the
+	// response body.
+	// Default is: 15 seconds.
+	Timeout time.Duration
+
+	// MaxIdleConns is the maximum number of idle connections across all
+	// hosts.
+	// Default is: 100.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept
+	// per host.
+	// Default is: 10.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost is the maximum number of connections per host,
+	// including those in use.
+	// Default is: no limit.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept.
+	// Default is: 90 seconds.
+	IdleConnTimeout time.Duration
+
+	// DialTimeout is the time limit for establishing a connection.
+	// Default is: 30 seconds.
+	DialTimeout time.Duration
+
+	// TLSHandshakeTimeout is the time limit for a TLS handshake.
+	// Default is: 10 seconds.
+	TLSHandshakeTimeout time.Duration
+
+	// TLSConfig is the base TLS configuration. The other TLS options are
+	// applied to a copy of it.
+	// Default is: the standard library's defaults.
+	TLSConfig *tls.Config
+
+	// CAFile is the path of a PEM file of certificate authorities, trusted
+	// in addition to the system's.
+	CAFile string
+
+	// CertFile and KeyFile are the paths of a PEM client certificate and
+	// its key, for mutual TLS.
+	CertFile string
+	KeyFile  string
+
+	// TLSMinVersion is the minimum TLS version, e.g. tls.VersionTLS12.
+	// Default is: the standard library's default.
+	TLSMinVersion uint16
+
+	// DisableHTTP2 disables HTTP/2, which is otherwise attempted for TLS
+	// connections.
+	DisableHTTP2 bool
+
+	// Proxy returns the proxy for a request.
+	// Default is: http.ProxyFromEnvironment.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// DNSResolver, when set, resolves and caches DNS lookups. It may be
+	// shared by several transports, and is owned by the caller, who stops
+	// it once they are no longer used.
+	DNSResolver *dnscache.Resolver
+}
+
+// withDefaults returns a copy of the options with defaults applied.
+func (o Options) withDefaults() Options {
+	if o.Timeout == 0 {
+		o.Timeout = 15 * time.Second
+	}
+
+	if o.MaxIdleConns == 0 {
+		o.MaxIdleConns = 100
+	}
+
+	if o.MaxIdleConnsPerHost == 0 {
+		o.MaxIdleConnsPerHost = 10
+	}
+
+	if o.IdleConnTimeout == 0 {
+		o.IdleConnTimeout = 90 * time.Second
+	}
+
+	if o.DialTimeout == 0 {
+		o.DialTimeout = 30 * time.Second
+	}
+
+	if o.TLSHandshakeTimeout == 0 {
+		o.TLSHandshakeTimeout = 10 * time.Second
+	}
+
+	if o.Proxy == nil {
+		o.Proxy = http.ProxyFromEnvironment
+	}
+
+	return o
+}
+
+// tlsVersions maps the TLS versions accepted by OptionsFromEnv.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// OptionsFromEnv returns Options from config variables, with unset
+// variables left to their defaults:
+//
+//	DAL_TIMEOUT                  e.g. "15s"
+//	DAL_MAX_IDLE_CONNS
+//	DAL_MAX_IDLE_CONNS_PER_HOST
+//	DAL_MAX_CONNS_PER_HOST
+//	DAL_IDLE_CONN_TIMEOUT        e.g. "90s"
+//	DAL_DIAL_TIMEOUT             e.g. "30s"
+//	DAL_TLS_HANDSHAKE_TIMEOUT    e.g. "10s"
+//	DAL_TLS_CA_FILE
+//	DAL_TLS_CERT_FILE
+//	DAL_TLS_KEY_FILE
+//	DAL_TLS_MIN_VERSION          one of "1.0", "1.1", "1.2", "1.3"
+//	DAL_DISABLE_HTTP2            e.g. "true"
+//	DAL_PROXY_URL
+func OptionsFromEnv() (Options, error) {
+	opts := Options{
+		Timeout:             viper.GetDuration("DAL_TIMEOUT"),
+		MaxIdleConns:        viper.GetInt("DAL_MAX_IDLE_CONNS"),
+		MaxIdleConnsPerHost: viper.GetInt("DAL_MAX_IDLE_CONNS_PER_HOST"),
+		MaxConnsPerHost:     viper.GetInt("DAL_MAX_CONNS_PER_HOST"),
+		IdleConnTimeout:     viper.GetDuration("DAL_IDLE_CONN_TIMEOUT"),
+		DialTimeout:         viper.GetDuration("DAL_DIAL_TIMEOUT"),
+		TLSHandshakeTimeout: viper.GetDuration("DAL_TLS_HANDSHAKE_TIMEOUT"),
+		CAFile:              viper.GetString("DAL_TLS_CA_FILE"),
+		CertFile:            viper.GetString("DAL_TLS_CERT_FILE"),
+		KeyFile:             viper.GetString("DAL_TLS_KEY_FILE"),
+		DisableHTTP2:        viper.GetBool("DAL_DISABLE_HTTP2"),
+	}
+
+	if v := viper.GetString("DAL_TLS_MIN_VERSION"); v != "" {
+		version, ok := tlsVersions[v]
+		if !ok {
+			return opts, fmt.Errorf("client: invalid DAL_TLS_MIN_VERSION %q", v)
+		}
+
+		opts.TLSMinVersion = version
+	}
+
+	if v := viper.GetString("DAL_PROXY_URL"); v != "" {
+		proxyURL, err := url.Parse(v)
+		if err != nil {
+			return opts, fmt.Errorf("client: invalid DAL_PROXY_URL: %w", err)
+		}
+
+		opts.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return opts, nil
+}
+
+// tlsConfig returns the TLS configuration for the options.
+func (o Options) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if o.TLSConfig != nil {
+		cfg = o.TLSConfig.Clone()
+	}
+
+	if o.TLSMinVersion != 0 {
+		cfg.MinVersion = o.TLSMinVersion
+	}
+
+	if o.CAFile != "" {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := cfg.RootCAs
+		if pool == nil {
+			if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client: no certificates found in %s", o.CAFile)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, errors.New("client: both a certificate and key file are required")
+		}
+
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	return cfg, nil
+}
+
+// NewTransport returns an http.Transport configured by the options.
+func NewTransport(opts Options) (*http.Transport, error) {
+	opts = opts.withDefaults()
+
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	t := &http.Transport{
+		Proxy:                 opts.Proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+	}
+
+	if opts.DNSResolver != nil {
+		opts.DNSResolver.Attach(t)
+	}
+
+	if opts.DisableHTTP2 {
+		// a non-nil, empty map disables HTTP/2
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	return t, nil
+}
+
+// NewHTTPClient returns an http.Client configured by the options.
+func NewHTTPClient(opts Options) (*http.Client, error) {
+	t, err := NewTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Timeout:   opts.withDefaults().Timeout,
+		Transport: t,
+	}, nil
+}
+
+// NewWithOptions returns a new Client instance, whose http.Client is
+// configured by the options.
+func NewWithOptions(opts Options) (*Client, error) {
+	hc, err := NewHTTPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return New().SetHTTPClient(hc), nil
+}
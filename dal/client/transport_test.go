@@ -0,0 +1,158 @@
+package client
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nickhstr/goweb/dnscache"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTransport(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		assert func(*assert.Assertions, *http.Transport)
+	}{
+		{
+			"should use defaults",
+			Options{},
+			func(assert *assert.Assertions, tr *http.Transport) {
+				assert.Equal(100, tr.MaxIdleConns)
+				assert.Equal(10, tr.MaxIdleConnsPerHost)
+				assert.Equal(90*time.Second, tr.IdleConnTimeout)
+				assert.True(tr.ForceAttemptHTTP2)
+				assert.Nil(tr.TLSNextProto)
+			},
+		},
+		{
+			"should set connection limits",
+			Options{MaxIdleConnsPerHost: 50, MaxConnsPerHost: 100},
+			func(assert *assert.Assertions, tr *http.Transport) {
+				assert.Equal(50, tr.MaxIdleConnsPerHost)
+				assert.Equal(100, tr.MaxConnsPerHost)
+			},
+		},
+		{
+			"should disable HTTP/2",
+			Options{DisableHTTP2: true},
+			func(assert *assert.Assertions, tr *http.Transport) {
+				assert.False(tr.ForceAttemptHTTP2)
+				assert.NotNil(tr.TLSNextProto)
+			},
+		},
+		{
+			"should set TLS min version",
+			Options{TLSMinVersion: tls.VersionTLS13},
+			func(assert *assert.Assertions, tr *http.Transport) {
+				assert.Equal(uint16(tls.VersionTLS13), tr.TLSClientConfig.MinVersion)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			tr, err := NewTransport(test.opts)
+			if assert.Nil(err) {
+				test.assert(assert, tr)
+			}
+		})
+	}
+}
+
+func TestNewTransportErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{
+			"should fail for a missing CA file",
+			Options{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		},
+		{
+			"should fail for a certificate without a key",
+			Options{CertFile: "cert.pem"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewTransport(test.opts)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestNewWithOptionsCAFile(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := dnscache.NewResolver(dnscache.Options{})
+	defer resolver.Stop()
+
+	c, err := NewWithOptions(Options{CAFile: caFile, DNSResolver: resolver})
+	if !assert.Nil(err) {
+		return
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.SetSkipCache(true).Do(req)
+
+	if assert.Nil(err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal("ok", string(body))
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	viper.Set("DAL_TIMEOUT", "5s")
+	viper.Set("DAL_MAX_CONNS_PER_HOST", "20")
+	viper.Set("DAL_TLS_MIN_VERSION", "1.2")
+	viper.Set("DAL_PROXY_URL", "http://proxy.local:3128")
+
+	defer func() {
+		for _, key := range []string{"DAL_TIMEOUT", "DAL_MAX_CONNS_PER_HOST", "DAL_TLS_MIN_VERSION", "DAL_PROXY_URL"} {
+			viper.Set(key, nil)
+		}
+	}()
+
+	opts, err := OptionsFromEnv()
+	if !assert.Nil(err) {
+		return
+	}
+
+	assert.Equal(5*time.Second, opts.Timeout)
+	assert.Equal(20, opts.MaxConnsPerHost)
+	assert.Equal(uint16(tls.VersionTLS12), opts.TLSMinVersion)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://foo.com", nil)
+	proxy, _ := opts.Proxy(req)
+	assert.Equal("proxy.local:3128", proxy.Host)
+
+	viper.Set("DAL_TLS_MIN_VERSION", "2.0")
+
+	_, err = OptionsFromEnv()
+	assert.NotNil(err)
+}
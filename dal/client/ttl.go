@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTTL is the TTL of responses which give no explicit freshness
+// information.
+const defaultTTL = 60 * time.Second
+
+// cacheControl holds a response's Cache-Control directives, by lowercase
+// name. Directives without a value map to an empty string.
+type cacheControl map[string]string
+
+// parseCacheControl parses the directives of all of the header's
+// Cache-Control values.
+func parseCacheControl(h http.Header) cacheControl {
+	cc := make(cacheControl)
+
+	for _, val := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(val, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+
+			name, value := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				name, value = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, ok := cc[name]; !ok {
+				cc[name] = value
+			}
+		}
+	}
+
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns the directive's value as a duration. An invalid value
+// is treated as zero, making the response stale.
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	val, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+
+	secs, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || secs < 0 {
+		return 0, true
+	}
+
+	return time.Duration(secs) * time.Second, true
+}
+
+// ttlFromResponse returns how long the response is fresh for a shared
+// cache, following RFC 7234, and whether it may be stored at all.
+// Freshness comes from, in order of precedence, the s-maxage and max-age
+// Cache-Control directives and the Expires header, less the response's age.
+// Responses with a no-cache directive have no freshness: they must be
+// revalidated before every use. Responses with no-store or private
+// directives may not be stored. Responses without any freshness
+// information are fresh for a default of 60 seconds.
+func ttlFromResponse(r *http.Response, now time.Time) (time.Duration, bool) {
+	cc := parseCacheControl(r.Header)
+
+	if cc.has("no-store") || cc.has("private") {
+		return 0, false
+	}
+
+	if cc.has("no-cache") {
+		return 0, true
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	hasDate := err == nil
+
+	lifetime, ok := cc.seconds("s-maxage")
+	if !ok {
+		lifetime, ok = cc.seconds("max-age")
+	}
+
+	if !ok {
+		if expires := r.Header.Get("Expires"); expires != "" {
+			ok = true
+
+			// an invalid Expires, such as "0", means already expired
+			if t, err := http.ParseTime(expires); err == nil {
+				if hasDate {
+					lifetime = t.Sub(date)
+				} else {
+					lifetime = t.Sub(now)
+				}
+			}
+		}
+	}
+
+	if !ok {
+		return defaultTTL, true
+	}
+
+	ttl := lifetime - responseAge(r.Header, hasDate, date, now)
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	return ttl, true
+}
+
+// responseAge returns the response's current age: the greater of its Age
+// header and the time since its Date header.
+func responseAge(h http.Header, hasDate bool, date, now time.Time) time.Duration {
+	var age time.Duration
+
+	if secs, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && secs > 0 {
+		age = time.Duration(secs) * time.Second
+	}
+
+	if hasDate {
+		if apparent := now.Sub(date); apparent > age {
+			age = apparent
+		}
+	}
+
+	return age
+}
+
+// responseTTL returns the TTL for caching the response, and whether it may
+// be stored at all.
+// A TTL from the request's context (see WithTTL), or else the Client's
+// fixed TTL, if set, overrides the response's freshness, but not its
+// no-store or private directives. Otherwise, the TTL derived from
+// the response is clamped to the Client's minimum and maximum TTLs, except
+// when it is zero: such responses must always be revalidated.
+func (c *Client) responseTTL(ctx context.Context, r *http.Response) (time.Duration, bool) {
+	ttl, ok := ttlFromResponse(r, time.Now())
+	if !ok {
+		return 0, false
+	}
+
+	if ttl, ok := ttlFromContext(ctx); ok {
+		return ttl, true
+	}
+
+	if c.ttl > 0 {
+		return c.ttl, true
+	}
+
+	if ttl == 0 {
+		return 0, true
+	}
+
+	if c.minTTL > 0 && ttl < c.minTTL {
+		ttl = c.minTTL
+	}
+
+	if c.maxTTL > 0 && ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+
+	return ttl, true
+}
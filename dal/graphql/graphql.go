@@ -0,0 +1,430 @@
+// Package graphql provides a GraphQL client built on the DAL client.
+//
+// Queries are sent as GET requests, so that their responses are cached by
+// the DAL client like any other, under a key made from the query's hash
+// and its variables. Queries too long for a URL, or all queries if so set
+// with SetQueryMethod, are sent as POST requests, as are mutations, which
+// are never cached.
+//
+//	c := graphql.New("https://foo.com/graphql").SetPersistedQueries(true)
+//
+//	var out struct {
+//		User struct {
+//			Name string `json:"name"`
+//		} `json:"user"`
+//	}
+//	err := c.Query(ctx, `query ($id: ID!) { user(id: $id) { name } }`, vars, &out)
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nickhstr/goweb/dal/client"
+)
+
+// maxGETURLLength is the length of the longest URL queries are sent in,
+// which most servers and proxies accept; longer queries are sent as POST
+// requests.
+const maxGETURLLength = 2048
+
+// persistedQueryNotFound is the error code, and message, with which servers
+// reject unknown persisted queries.
+const (
+	persistedQueryNotFound     = "PERSISTED_QUERY_NOT_FOUND"
+	persistedQueryNotFoundText = "PersistedQueryNotFound"
+)
+
+// Operation is a GraphQL query or mutation.
+type Operation struct {
+	// Query is the operation's document.
+	Query string
+	// OperationName selects the operation to run, when the document has
+	// several.
+	OperationName string
+	// Variables are the operation's variables, marshaled as JSON: a map,
+	// or a struct with json tags.
+	Variables interface{}
+}
+
+// Location is a location in a GraphQL document.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is a GraphQL error.
+type Error struct {
+	Message    string                     `json:"message"`
+	Locations  []Location                 `json:"locations,omitempty"`
+	Path       []interface{}              `json:"path,omitempty"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return "graphql: " + e.Message
+}
+
+// Extension decodes the named extension of the error into v, returning
+// false if the error has no such extension.
+func (e *Error) Extension(name string, v interface{}) (bool, error) {
+	raw, ok := e.Extensions[name]
+	if !ok {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(raw, v)
+}
+
+// Code returns the error's "code" extension, if any.
+func (e *Error) Code() string {
+	var code string
+	_, _ = e.Extension("code", &code)
+
+	return code
+}
+
+// Errors are the GraphQL errors of a response. They are returned along
+// with any data the response also had, which is still decoded.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// response is a GraphQL response.
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors Errors          `json:"errors"`
+}
+
+// Client is a GraphQL client for an endpoint.
+type Client struct {
+	endpoint    string
+	dalClient   *client.Client
+	persisted   bool
+	queryMethod string
+}
+
+// New returns a new Client for the endpoint, using a new DAL Client.
+func New(endpoint string) *Client {
+	return &Client{
+		endpoint:    endpoint,
+		dalClient:   client.New(),
+		queryMethod: http.MethodGet,
+	}
+}
+
+// SetDALClient sets the DAL Client which sends requests, and caches query
+// responses.
+func (c *Client) SetDALClient(dc *client.Client) *Client {
+	c.dalClient = dc
+	return c
+}
+
+// SetPersistedQueries enables automatic persisted queries (APQ): requests
+// carry only the query's SHA-256 hash, and the full query is sent only if
+// the server does not know the hash yet.
+// Default is: false.
+func (c *Client) SetPersistedQueries(enabled bool) *Client {
+	c.persisted = enabled
+	return c
+}
+
+// SetQueryMethod sets the HTTP method queries are sent with: GET, whose
+// responses the DAL client caches, or POST, for servers which reject
+// queries sent as GET requests, e.g. to prevent CSRF. GET queries too long
+// for a URL are sent as POST requests regardless.
+// Default is: GET.
+func (c *Client) SetQueryMethod(method string) *Client {
+	if method == http.MethodPost {
+		c.queryMethod = http.MethodPost
+	} else {
+		c.queryMethod = http.MethodGet
+	}
+
+	return c
+}
+
+// Query runs a query, decoding its data into out.
+func (c *Client) Query(ctx context.Context, query string, variables, out interface{}) error {
+	return c.Do(ctx, Operation{Query: query, Variables: variables}, false, out)
+}
+
+// Mutate runs a mutation, decoding its data into out.
+func (c *Client) Mutate(ctx context.Context, mutation string, variables, out interface{}) error {
+	return c.Do(ctx, Operation{Query: mutation, Variables: variables}, true, out)
+}
+
+// Do runs the operation, decoding its data into out, if not nil.
+// Queries are sent with the query method (see SetQueryMethod); mutations as
+// POST requests.
+// Errors is returned for responses with GraphQL errors, and a
+// *client.StatusError for other non-2xx responses.
+//
+// Responses with errors are cached as any other, following the server's
+// caching headers; use client.WithSkipCache or client.WithForceRefresh in
+// ctx to control caching per query.
+func (c *Client) Do(ctx context.Context, op Operation, mutation bool, out interface{}) error {
+	variables, err := marshalVariables(op.Variables)
+	if err != nil {
+		return err
+	}
+
+	hash := queryHash(op.Query)
+
+	if !mutation {
+		ctx = client.WithCacheKey(ctx, c.cacheKey(op, hash, variables))
+	}
+
+	if c.persisted {
+		resp, err := c.send(ctx, op, hash, variables, mutation, false)
+		if err != nil || !persistedQueryMissing(resp.Errors) {
+			return decode(resp, err, out)
+		}
+
+		// the cached "not found" response is replaced once the query is
+		// registered
+		ctx = client.WithForceRefresh(ctx)
+	}
+
+	resp, err := c.send(ctx, op, hash, variables, mutation, true)
+
+	return decode(resp, err, out)
+}
+
+// send sends the operation, with the query document only if withQuery is
+// set, and returns the decoded response.
+func (c *Client) send(
+	ctx context.Context,
+	op Operation,
+	hash string,
+	variables json.RawMessage,
+	mutation bool,
+	withQuery bool,
+) (*response, error) {
+	params := map[string]interface{}{}
+
+	if withQuery {
+		params["query"] = op.Query
+	}
+
+	if op.OperationName != "" {
+		params["operationName"] = op.OperationName
+	}
+
+	if variables != nil {
+		params["variables"] = variables
+	}
+
+	if c.persisted {
+		params["extensions"] = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{
+				"version":    1,
+				"sha256Hash": hash,
+			},
+		}
+	}
+
+	req, err := c.request(ctx, params, mutation || c.queryMethod == http.MethodPost)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.dalClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(c.dalClient.LimitBody(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	var r response
+
+	// servers may reply with a non-2xx status along with GraphQL errors,
+	// which are more helpful than the status alone
+	if err := json.Unmarshal(body, &r); err != nil || (r.Data == nil && r.Errors == nil) {
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			if len(body) > client.MaxErrorBodySize {
+				body = body[:client.MaxErrorBodySize]
+			}
+
+			return nil, &client.StatusError{
+				Method:     req.Method,
+				URL:        c.endpoint,
+				StatusCode: resp.StatusCode,
+				Body:       body,
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("graphql: invalid response: %w", err)
+		}
+	}
+
+	return &r, nil
+}
+
+// request returns the request carrying the parameters: a GET request with
+// query parameters, unless post is set or the URL would be too long, or a
+// POST request with a JSON body.
+func (c *Client) request(ctx context.Context, params map[string]interface{}, post bool) (*http.Request, error) {
+	if !post {
+		req, err := c.getRequest(ctx, params)
+		if err != nil || len(req.URL.String()) <= maxGETURLLength {
+			return req, err
+		}
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	return req, nil
+}
+
+// getRequest returns a GET request carrying the parameters in its URL.
+func (c *Client) getRequest(ctx context.Context, params map[string]interface{}) (*http.Request, error) {
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+
+	for name, v := range params {
+		if s, ok := v.(string); ok {
+			q.Set(name, s)
+			continue
+		}
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		q.Set(name, string(data))
+	}
+
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	return req, nil
+}
+
+// cacheKey returns the cache key of a query's response, made from the
+// endpoint, the query's hash, its operation name and its variables.
+func (c *Client) cacheKey(op Operation, hash string, variables json.RawMessage) string {
+	key := "graphql:" + c.endpoint + ":" + hash
+
+	if op.OperationName != "" {
+		key += ":" + op.OperationName
+	}
+
+	if variables != nil {
+		key += ":" + queryHash(string(variables))
+	}
+
+	return key
+}
+
+// decode decodes the response's data into out, returning its errors, if
+// any.
+func decode(r *response, err error, out interface{}) error {
+	if err != nil {
+		return err
+	}
+
+	if out != nil && len(r.Data) > 0 && string(r.Data) != "null" {
+		if err := json.Unmarshal(r.Data, out); err != nil {
+			return fmt.Errorf("graphql: invalid data: %w", err)
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		return r.Errors
+	}
+
+	return nil
+}
+
+// marshalVariables returns the canonical JSON encoding of the variables,
+// with object keys sorted, so that equal variables share cache keys
+// whatever their Go type.
+func marshalVariables(variables interface{}) (json.RawMessage, error) {
+	if variables == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(variables)
+	if err != nil {
+		return nil, fmt.Errorf("graphql: invalid variables: %w", err)
+	}
+
+	var v interface{}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	if err := d.Decode(&v); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if v == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(v)
+}
+
+// queryHash returns the hex encoded SHA-256 hash of the query, as used by
+// persisted queries.
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// persistedQueryMissing reports whether the errors include the server not
+// knowing a persisted query.
+func persistedQueryMissing(errs Errors) bool {
+	for _, err := range errs {
+		if err.Code() == persistedQueryNotFound || err.Message == persistedQueryNotFoundText {
+			return true
+		}
+	}
+
+	return false
+}
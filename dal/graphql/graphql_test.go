@@ -0,0 +1,318 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nickhstr/goweb/dal/client"
+	"github.com/nickhstr/goweb/internal/cachetest"
+	"github.com/stretchr/testify/assert"
+)
+
+const userQuery = `query ($id: ID!) { user(id: $id) { name } }`
+
+type userVars struct {
+	ID string `json:"id"`
+}
+
+type userData struct {
+	User struct {
+		Name string `json:"name"`
+	} `json:"user"`
+}
+
+// server is a fake GraphQL server, answering every operation with the
+// requested user's name and a count of requests received.
+type server struct {
+	mu        sync.Mutex
+	requests  []*http.Request
+	persisted map[string]bool
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r)
+
+	params := map[string]string{}
+
+	if r.Method == http.MethodPost {
+		var body map[string]json.RawMessage
+		data, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+
+		for k, v := range body {
+			var s string
+			if json.Unmarshal(v, &s) != nil {
+				s = string(v)
+			}
+			params[k] = s
+		}
+	} else {
+		for k := range r.URL.Query() {
+			params[k] = r.URL.Query().Get(k)
+		}
+	}
+
+	query := params["query"]
+
+	if ext := params["extensions"]; ext != "" {
+		var e struct {
+			PersistedQuery struct {
+				Hash string `json:"sha256Hash"`
+			} `json:"persistedQuery"`
+		}
+		_ = json.Unmarshal([]byte(ext), &e)
+
+		if query == "" && !s.persisted[e.PersistedQuery.Hash] {
+			fmt.Fprint(w, `{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`)
+			return
+		}
+
+		s.persisted[e.PersistedQuery.Hash] = true
+	}
+
+	var vars userVars
+	_ = json.Unmarshal([]byte(params["variables"]), &vars)
+
+	if vars.ID == "missing" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"data":null,"errors":[{"message":"user not found","path":["user"],"extensions":{"code":"NOT_FOUND","retryable":false}}]}`)
+		return
+	}
+
+	if vars.ID == "broken" {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, "bad gateway")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "max-age=60")
+	fmt.Fprintf(w, `{"data":{"user":{"name":"user %s (%d)"}}}`, vars.ID, len(s.requests))
+}
+
+func (s *server) reset() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := s.requests
+	s.requests = nil
+
+	return requests
+}
+
+func newTestClient(t *testing.T) (*Client, *server) {
+	s := &server{persisted: map[string]bool{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	dc := client.New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+
+	return New(srv.URL + "/graphql").SetDALClient(dc), s
+}
+
+func TestClientQuery(t *testing.T) {
+	assert := assert.New(t)
+	c, s := newTestClient(t)
+
+	var out userData
+	assert.Nil(c.Query(context.Background(), userQuery, userVars{"1"}, &out))
+	assert.Equal("user 1 (1)", out.User.Name)
+
+	reqs := s.reset()
+	if assert.Len(reqs, 1) {
+		assert.Equal(http.MethodGet, reqs[0].Method)
+		assert.Equal(userQuery, reqs[0].URL.Query().Get("query"))
+		assert.Equal(`{"id":"1"}`, reqs[0].URL.Query().Get("variables"))
+	}
+
+	// equal variables share cached responses, whatever their type
+	out = userData{}
+	assert.Nil(c.Query(context.Background(), userQuery, map[string]interface{}{"id": "1"}, &out))
+	assert.Equal("user 1 (1)", out.User.Name)
+	assert.Empty(s.reset())
+
+	out = userData{}
+	assert.Nil(c.Query(context.Background(), userQuery, userVars{"2"}, &out))
+	assert.Equal("user 2 (1)", out.User.Name)
+	assert.Len(s.reset(), 1)
+}
+
+func TestClientQueryMethod(t *testing.T) {
+	t.Run("should send queries as POST requests", func(t *testing.T) {
+		assert := assert.New(t)
+		c, s := newTestClient(t)
+		c.SetQueryMethod(http.MethodPost)
+
+		var out userData
+		assert.Nil(c.Query(context.Background(), userQuery, userVars{"1"}, &out))
+		assert.Equal("user 1 (1)", out.User.Name)
+
+		reqs := s.reset()
+		if assert.Len(reqs, 1) {
+			assert.Equal(http.MethodPost, reqs[0].Method)
+		}
+	})
+
+	t.Run("should send long queries as POST requests", func(t *testing.T) {
+		assert := assert.New(t)
+		c, s := newTestClient(t)
+		query := userQuery + strings.Repeat(" ", maxGETURLLength)
+
+		var out userData
+		assert.Nil(c.Query(context.Background(), query, userVars{"1"}, &out))
+		assert.Equal("user 1 (1)", out.User.Name)
+
+		reqs := s.reset()
+		if assert.Len(reqs, 1) {
+			assert.Equal(http.MethodPost, reqs[0].Method)
+		}
+	})
+
+	t.Run("should send hashes of long persisted queries as GET requests", func(t *testing.T) {
+		assert := assert.New(t)
+		c, s := newTestClient(t)
+		c.SetPersistedQueries(true)
+		query := userQuery + strings.Repeat(" ", maxGETURLLength)
+
+		var out userData
+		assert.Nil(c.Query(context.Background(), query, userVars{"1"}, &out))
+		assert.Equal("user 1 (2)", out.User.Name)
+
+		reqs := s.reset()
+		if assert.Len(reqs, 2) {
+			assert.Equal(http.MethodGet, reqs[0].Method)
+			assert.Equal(http.MethodPost, reqs[1].Method)
+		}
+	})
+}
+
+func TestClientMutate(t *testing.T) {
+	assert := assert.New(t)
+	c, s := newTestClient(t)
+
+	for i := 1; i <= 2; i++ {
+		var out userData
+		assert.Nil(c.Mutate(context.Background(), userQuery, userVars{"1"}, &out))
+		assert.Equal(fmt.Sprintf("user 1 (%d)", i), out.User.Name)
+	}
+
+	for _, req := range s.reset() {
+		assert.Equal(http.MethodPost, req.Method)
+	}
+}
+
+func TestClientPersistedQueries(t *testing.T) {
+	assert := assert.New(t)
+	c, s := newTestClient(t)
+	c.SetPersistedQueries(true)
+
+	var out userData
+	assert.Nil(c.Query(context.Background(), userQuery, userVars{"1"}, &out))
+	assert.Equal("user 1 (2)", out.User.Name)
+
+	reqs := s.reset()
+	if assert.Len(reqs, 2) {
+		assert.Empty(reqs[0].URL.Query().Get("query"))
+		assert.Equal(userQuery, reqs[1].URL.Query().Get("query"))
+		assert.Contains(reqs[1].URL.Query().Get("extensions"), queryHash(userQuery))
+	}
+
+	// the registered query's response replaced the cached "not found"
+	out = userData{}
+	assert.Nil(c.Query(context.Background(), userQuery, userVars{"1"}, &out))
+	assert.Equal("user 1 (2)", out.User.Name)
+	assert.Empty(s.reset())
+
+	// known queries are sent by hash alone
+	out = userData{}
+	assert.Nil(c.Mutate(context.Background(), userQuery, userVars{"2"}, &out))
+	assert.Equal("user 2 (1)", out.User.Name)
+
+	reqs = s.reset()
+	if assert.Len(reqs, 1) {
+		assert.Equal(http.MethodPost, reqs[0].Method)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	t.Run("should decode GraphQL errors", func(t *testing.T) {
+		assert := assert.New(t)
+		c, _ := newTestClient(t)
+
+		var out userData
+		err := c.Query(context.Background(), userQuery, userVars{"missing"}, &out)
+
+		var errs Errors
+		if assert.True(errors.As(err, &errs)) && assert.Len(errs, 1) {
+			assert.Equal("user not found", errs[0].Message)
+			assert.Equal([]interface{}{"user"}, errs[0].Path)
+			assert.Equal("NOT_FOUND", errs[0].Code())
+
+			var retryable bool
+			ok, err := errs[0].Extension("retryable", &retryable)
+			assert.True(ok)
+			assert.Nil(err)
+			assert.False(retryable)
+
+			ok, _ = errs[0].Extension("foo", &retryable)
+			assert.False(ok)
+		}
+	})
+
+	t.Run("should return status errors", func(t *testing.T) {
+		assert := assert.New(t)
+		c, _ := newTestClient(t)
+
+		err := c.Query(context.Background(), userQuery, userVars{"broken"}, nil)
+
+		var statusErr *client.StatusError
+		if assert.True(errors.As(err, &statusErr)) {
+			assert.Equal(http.StatusBadGateway, statusErr.StatusCode)
+			assert.Equal("bad gateway", string(statusErr.Body))
+		}
+	})
+
+	t.Run("should limit response size", func(t *testing.T) {
+		c, _ := newTestClient(t)
+		c.dalClient.SetMaxResponseSize(10)
+
+		err := c.Query(context.Background(), userQuery, userVars{"1"}, nil)
+		assert.True(t, errors.Is(err, client.ErrResponseTooLarge))
+	})
+
+	t.Run("should reject invalid variables", func(t *testing.T) {
+		c, _ := newTestClient(t)
+		assert.NotNil(t, c.Query(context.Background(), userQuery, func() {}, nil))
+	})
+}
+
+func TestMarshalVariables(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables interface{}
+		expected  string
+	}{
+		{"nil", nil, ""},
+		{"null", json.RawMessage("null"), ""},
+		{"struct", userVars{"1"}, `{"id":"1"}`},
+		{"sorted keys", json.RawMessage(`{"b":1,"a":{"d":2.50,"c":1e3}}`), `{"a":{"c":1e3,"d":2.50},"b":1}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := marshalVariables(test.variables)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, string(data))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package recorder
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+)
+
+// Matcher reports whether a request, with the given body, matches a
+// recorded request.
+type Matcher func(req *http.Request, body []byte, recorded Request) bool
+
+// MatchMethod matches requests with the same method.
+func MatchMethod(req *http.Request, body []byte, recorded Request) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL matches requests with the same URL, including the query.
+func MatchURL(req *http.Request, body []byte, recorded Request) bool {
+	return req.URL.String() == recorded.URL
+}
+
+// MatchBody matches requests with the same body.
+func MatchBody(req *http.Request, body []byte, recorded Request) bool {
+	return bytes.Equal(body, recorded.Body)
+}
+
+// MatchHeaders returns a Matcher which matches requests with the same
+// values for the named headers.
+func MatchHeaders(names ...string) Matcher {
+	return func(req *http.Request, body []byte, recorded Request) bool {
+		for _, name := range names {
+			if !reflect.DeepEqual(req.Header.Values(name), recorded.Header.Values(name)) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// MatchAll returns a Matcher which matches requests matched by all of the
+// given Matchers.
+func MatchAll(matchers ...Matcher) Matcher {
+	return func(req *http.Request, body []byte, recorded Request) bool {
+		for _, m := range matchers {
+			if !m(req, body, recorded) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
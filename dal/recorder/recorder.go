@@ -0,0 +1,352 @@
+// Package recorder provides an http.RoundTripper which records requests
+// and their responses to a fixture file, and replays them, so that tests of
+// code using the DAL client can run without real upstreams.
+//
+// A Recorder is used as the transport of the DAL client's http.Client:
+//
+//	rec, err := recorder.New(recorder.Options{
+//		Mode: recorder.ModeReplay,
+//		Path: "testdata/users.json",
+//	})
+//	c := client.New().SetHTTPClient(&http.Client{Transport: rec})
+//
+// Fixtures are recorded by running the same code with ModeRecord, against
+// real upstreams, then calling Save.
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// Mode is the mode of a Recorder.
+type Mode int
+
+const (
+	// ModeReplay serves recorded responses, failing requests which match
+	// no recorded interaction.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests with the Recorder's transport, and records
+	// them and their responses.
+	ModeRecord
+)
+
+// ErrNoMatch is matched, using errors.Is, by errors returned for requests
+// which match no recorded interaction.
+var ErrNoMatch = errors.New("recorder: no recorded interaction matches request")
+
+// redacted replaces the values of sanitized headers.
+const redacted = "[REDACTED]"
+
+// defaultSanitizeHeaders are the headers sanitized by default, as they
+// commonly carry credentials.
+var defaultSanitizeHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+	"X-Api-Key",
+}
+
+// Options are the configurable options for a Recorder.
+type Options struct {
+	// Mode is the Recorder's mode.
+	// Default is: ModeReplay.
+	Mode Mode
+
+	// Path is the path of the fixture file.
+	Path string
+
+	// Transport sends requests in ModeRecord.
+	// Default is: http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// SanitizeHeaders are the request and response headers whose values
+	// are redacted in recorded interactions. Matchers in ModeReplay see
+	// the redacted values.
+	// Default is: Authorization, Cookie, Proxy-Authorization, Set-Cookie
+	// and X-Api-Key.
+	SanitizeHeaders []string
+
+	// Matcher reports whether a request matches a recorded interaction.
+	// Default is: MatchAll(MatchMethod, MatchURL).
+	Matcher Matcher
+}
+
+// Body is a recorded request or response body. Bodies which are valid
+// UTF-8 are recorded as is; other bodies are base64 encoded.
+type Body []byte
+
+// MarshalJSON encodes the body as a string, base64 encoded with a
+// "base64:" prefix if it is not valid UTF-8.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) && !bytes.HasPrefix(b, []byte(base64Prefix)) {
+		return json.Marshal(string(b))
+	}
+
+	return json.Marshal(base64Prefix + base64.StdEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes a body encoded by MarshalJSON.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	if len(s) < len(base64Prefix) || s[:len(base64Prefix)] != base64Prefix {
+		*b = Body(s)
+		return nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(s[len(base64Prefix):])
+	if err != nil {
+		return err
+	}
+
+	*b = decoded
+
+	return nil
+}
+
+const base64Prefix = "base64:"
+
+// Request is a recorded request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Recorder is an http.RoundTripper which records or replays interactions.
+type Recorder struct {
+	opts Options
+
+	mu           sync.Mutex
+	interactions []Interaction
+	// replayed marks the interactions already replayed, so that identical
+	// requests are served their recorded responses in order.
+	replayed []bool
+}
+
+// New returns a new Recorder. In ModeReplay, the fixture file is loaded,
+// and must exist.
+func New(opts Options) (*Recorder, error) {
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+
+	if opts.SanitizeHeaders == nil {
+		opts.SanitizeHeaders = defaultSanitizeHeaders
+	}
+
+	if opts.Matcher == nil {
+		opts.Matcher = MatchAll(MatchMethod, MatchURL)
+	}
+
+	r := &Recorder{opts: opts}
+
+	if opts.Mode == ModeReplay {
+		data, err := ioutil.ReadFile(opts.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &r.interactions); err != nil {
+			return nil, fmt.Errorf("recorder: invalid fixture %s: %w", opts.Path, err)
+		}
+
+		r.replayed = make([]bool, len(r.interactions))
+	}
+
+	return r, nil
+}
+
+// Interactions returns the recorded interactions.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// Save writes the recorded interactions to the fixture file, creating its
+// directory if needed. It does nothing in ModeReplay.
+func (r *Recorder) Save() error {
+	if r.opts.Mode == ModeReplay {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.Interactions(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.opts.Path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.opts.Path, append(data, '\n'), 0644)
+}
+
+// RoundTrip records or replays the request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.opts.Mode == ModeRecord {
+		return r.record(req, body)
+	}
+
+	return r.replay(req, body)
+}
+
+// readBody reads the request's body, from a copy if the request has one,
+// and closes the request's body, as a RoundTripper must.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	defer req.Body.Close()
+
+	if req.GetBody != nil {
+		b, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer b.Close()
+
+		return ioutil.ReadAll(b)
+	}
+
+	return ioutil.ReadAll(req.Body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	if body != nil {
+		out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := r.opts.Transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: r.sanitize(req.Header),
+			Body:   body,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.sanitize(resp.Header),
+			Body:       respBody,
+		},
+	})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	// matchers see the request as it would have been recorded
+	sanitized := req.Clone(req.Context())
+	sanitized.Header = r.sanitize(req.Header)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match := -1
+
+	for i, in := range r.interactions {
+		if !r.opts.Matcher(sanitized, body, in.Request) {
+			continue
+		}
+
+		// prefer interactions not yet replayed, falling back to the last
+		// match, so that a request may be repeated
+		match = i
+		if !r.replayed[i] {
+			break
+		}
+	}
+
+	if match < 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoMatch, req.Method, req.URL)
+	}
+
+	r.replayed[match] = true
+	recorded := r.interactions[match].Response
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// sanitize returns a copy of the header, with the values of sanitized
+// headers redacted.
+func (r *Recorder) sanitize(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+
+	h = h.Clone()
+
+	for _, name := range r.opts.SanitizeHeaders {
+		if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+			h.Set(name, redacted)
+		}
+	}
+
+	return h
+}
+
+// sanity check for satisfaction of http.RoundTripper interface
+var _ http.RoundTripper = &Recorder{}
@@ -0,0 +1,186 @@
+package recorder
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nickhstr/goweb/dal/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "fixtures", "users.json")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte(r.Method + " " + r.URL.Path + " " + string(body)))
+	}))
+
+	do := func(rt http.RoundTripper, method, path, body string) (string, error) {
+		c := client.New().SetHTTPClient(&http.Client{Transport: rt}).SetSkipCache(true)
+
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+
+		resp, err := c.Do(req)
+		if err != nil {
+			return "", err
+		}
+
+		data, _ := ioutil.ReadAll(resp.Body)
+
+		return string(data), nil
+	}
+
+	rec, err := New(Options{Mode: ModeRecord, Path: path, Transport: srv.Client().Transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := do(rec, http.MethodGet, "/users/1", "")
+	assert.Nil(err)
+	assert.Equal("GET /users/1 ", body)
+
+	body, err = do(rec, http.MethodPost, "/users", `{"name":"foo"}`)
+	assert.Nil(err)
+	assert.Equal(`POST /users {"name":"foo"}`, body)
+
+	assert.Nil(rec.Save())
+
+	// the upstream is no longer needed
+	srv.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	assert.NotContains(string(data), "secret")
+
+	replay, err := New(Options{
+		Path:    path,
+		Matcher: MatchAll(MatchMethod, MatchURL, MatchBody),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err = do(replay, http.MethodPost, "/users", `{"name":"foo"}`)
+	assert.Nil(err)
+	assert.Equal(`POST /users {"name":"foo"}`, body)
+
+	// requests may be repeated
+	for i := 0; i < 2; i++ {
+		body, err = do(replay, http.MethodGet, "/users/1", "")
+		assert.Nil(err)
+		assert.Equal("GET /users/1 ", body)
+	}
+
+	_, err = do(replay, http.MethodPost, "/users", `{"name":"bar"}`)
+	assert.True(errors.Is(err, ErrNoMatch))
+
+	_, err = do(replay, http.MethodGet, "/users/2", "")
+	assert.True(errors.Is(err, ErrNoMatch))
+}
+
+func TestNewMissingFixture(t *testing.T) {
+	_, err := New(Options{Path: filepath.Join(t.TempDir(), "missing.json")})
+	assert.NotNil(t, err)
+}
+
+func TestMatchHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		recorded http.Header
+		expected bool
+	}{
+		{
+			"should match same values",
+			http.Header{"Accept": []string{"application/json"}, "X-Foo": []string{"a"}},
+			http.Header{"Accept": []string{"application/json"}, "X-Foo": []string{"b"}},
+			true,
+		},
+		{
+			"should not match different values",
+			http.Header{"Accept": []string{"application/json"}},
+			http.Header{"Accept": []string{"text/html"}},
+			false,
+		},
+		{
+			"should not match missing headers",
+			http.Header{},
+			http.Header{"Accept": []string{"text/html"}},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://foo.com", nil)
+			req.Header = test.header
+
+			matched := MatchHeaders("Accept")(req, nil, Request{Header: test.recorded})
+			assert.Equal(t, test.expected, matched)
+		})
+	}
+}
+
+func TestBodyJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body Body
+	}{
+		{"text", Body(`{"foo":"bar"}`)},
+		{"binary", Body{0xff, 0xfe, 0x00}},
+		{"text with prefix", Body(base64Prefix + "foo")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			data, err := test.body.MarshalJSON()
+			assert.Nil(err)
+
+			var b Body
+			assert.Nil(b.UnmarshalJSON(data))
+			assert.Equal(test.body, b)
+		})
+	}
+}
+
+// closeBody records whether a request body was closed.
+type closeBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (b *closeBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func Test_readBody(t *testing.T) {
+	for _, getBody := range []bool{false, true} {
+		assert := assert.New(t)
+		body := &closeBody{Reader: strings.NewReader("foo")}
+
+		req, _ := http.NewRequest(http.MethodPost, "http://foo.com", body)
+		if getBody {
+			req.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("foo")), nil
+			}
+		}
+
+		data, err := readBody(req)
+		assert.Nil(err)
+		assert.Equal("foo", string(data))
+		assert.True(body.closed)
+	}
+}
@@ -0,0 +1,307 @@
+package sling
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/dghubble/sling"
+	"github.com/nickhstr/goweb/dal/client"
+)
+
+// Builder builds and sends requests with a DAL Client. Unlike a plain
+// sling.Sling, requests carry a context, with which caching is controlled
+// per request, and non-2xx responses are returned as *client.StatusError.
+//
+// Builder methods modify and return the Builder; use New to copy a base
+// Builder before extending it.
+type Builder struct {
+	sling   *sling.Sling
+	client  *client.Client
+	ctx     context.Context
+	decoder sling.ResponseDecoder
+}
+
+// NewBuilder returns a Builder using the default DAL Client.
+func NewBuilder() *Builder {
+	return NewBuilderWithClient(dalClient)
+}
+
+// NewBuilderWithClient returns a Builder using the supplied DAL Client.
+func NewBuilderWithClient(c *client.Client) *Builder {
+	return &Builder{
+		sling:   sling.New().Doer(c),
+		client:  c,
+		ctx:     context.Background(),
+		decoder: jsonDecoder{},
+	}
+}
+
+// New returns a copy of the Builder, which may be extended without
+// affecting the original.
+func (b *Builder) New() *Builder {
+	copied := *b
+	copied.sling = b.sling.New()
+
+	return &copied
+}
+
+// Sling returns the underlying sling.Sling, for options not exposed by the
+// Builder.
+func (b *Builder) Sling() *sling.Sling {
+	return b.sling
+}
+
+// Context sets the context of requests.
+// Default is: context.Background().
+func (b *Builder) Context(ctx context.Context) *Builder {
+	b.ctx = ctx
+	return b
+}
+
+// TTL sets how long responses are cached, overriding both the Client's TTL
+// and the responses' freshness (see client.WithTTL).
+func (b *Builder) TTL(ttl time.Duration) *Builder {
+	b.ctx = client.WithTTL(b.ctx, ttl)
+	return b
+}
+
+// CacheKey sets the key under which responses are cached (see
+// client.WithCacheKey).
+func (b *Builder) CacheKey(key string) *Builder {
+	b.ctx = client.WithCacheKey(b.ctx, key)
+	return b
+}
+
+// ForceRefresh bypasses cached responses, while still caching fresh ones
+// (see client.WithForceRefresh).
+func (b *Builder) ForceRefresh() *Builder {
+	b.ctx = client.WithForceRefresh(b.ctx)
+	return b
+}
+
+// SkipCache neither uses nor stores cached responses (see
+// client.WithSkipCache).
+func (b *Builder) SkipCache() *Builder {
+	b.ctx = client.WithSkipCache(b.ctx)
+	return b
+}
+
+// Base sets the base URL. See sling.Sling.Base.
+func (b *Builder) Base(rawURL string) *Builder {
+	b.sling.Base(rawURL)
+	return b
+}
+
+// Path extends the URL with the given path. See sling.Sling.Path.
+func (b *Builder) Path(path string) *Builder {
+	b.sling.Path(path)
+	return b
+}
+
+// Get sets the method to GET, and extends the URL with the given path.
+func (b *Builder) Get(pathURL string) *Builder {
+	b.sling.Get(pathURL)
+	return b
+}
+
+// Head sets the method to HEAD, and extends the URL with the given path.
+func (b *Builder) Head(pathURL string) *Builder {
+	b.sling.Head(pathURL)
+	return b
+}
+
+// Post sets the method to POST, and extends the URL with the given path.
+func (b *Builder) Post(pathURL string) *Builder {
+	b.sling.Post(pathURL)
+	return b
+}
+
+// Put sets the method to PUT, and extends the URL with the given path.
+func (b *Builder) Put(pathURL string) *Builder {
+	b.sling.Put(pathURL)
+	return b
+}
+
+// Patch sets the method to PATCH, and extends the URL with the given path.
+func (b *Builder) Patch(pathURL string) *Builder {
+	b.sling.Patch(pathURL)
+	return b
+}
+
+// Delete sets the method to DELETE, and extends the URL with the given
+// path.
+func (b *Builder) Delete(pathURL string) *Builder {
+	b.sling.Delete(pathURL)
+	return b
+}
+
+// Add adds a header value.
+func (b *Builder) Add(key, value string) *Builder {
+	b.sling.Add(key, value)
+	return b
+}
+
+// Set sets a header value, replacing any existing values.
+func (b *Builder) Set(key, value string) *Builder {
+	b.sling.Set(key, value)
+	return b
+}
+
+// QueryStruct appends the url tagged struct to the URL's query. See
+// sling.Sling.QueryStruct.
+func (b *Builder) QueryStruct(queryStruct interface{}) *Builder {
+	b.sling.QueryStruct(queryStruct)
+	return b
+}
+
+// BodyJSON sets the request body to the JSON encoding of bodyJSON.
+func (b *Builder) BodyJSON(bodyJSON interface{}) *Builder {
+	b.sling.BodyJSON(bodyJSON)
+	return b
+}
+
+// BodyForm sets the request body to the form encoding of the url tagged
+// bodyForm.
+func (b *Builder) BodyForm(bodyForm interface{}) *Builder {
+	b.sling.BodyForm(bodyForm)
+	return b
+}
+
+// ResponseDecoder sets the decoder of response bodies.
+// Default is: a JSON decoder.
+func (b *Builder) ResponseDecoder(decoder sling.ResponseDecoder) *Builder {
+	if decoder != nil {
+		b.decoder = decoder
+	}
+
+	return b
+}
+
+// Request returns a new http.Request, with the Builder's context.
+func (b *Builder) Request() (*http.Request, error) {
+	req, err := b.sling.Request()
+	if err != nil {
+		return nil, err
+	}
+
+	return req.WithContext(b.ctx), nil
+}
+
+// ReceiveSuccess sends a request, and decodes a 2xx response into successV.
+// See Receive.
+func (b *Builder) ReceiveSuccess(successV interface{}) (*http.Response, error) {
+	return b.Receive(successV, nil)
+}
+
+// Receive sends a request, and decodes a 2xx response into successV, or
+// any other response into failureV; either may be nil to skip decoding.
+// A *client.StatusError is returned for non-2xx responses, even when
+// failureV is decoded, so that callers may rely on the error alone.
+// The response body is always closed.
+func (b *Builder) Receive(successV, failureV interface{}) (*http.Response, error) {
+	req, err := b.Request()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Do(req, successV, failureV)
+}
+
+// Do sends the request, decoding its response as Receive does.
+func (b *Builder) Do(req *http.Request, successV, failureV interface{}) (*http.Response, error) {
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+
+	defer resp.Body.Close()
+
+	// bodies are read no further than the Client's maximum response size
+	resp.Body = readCloser{b.client.LimitBody(resp.Body), resp.Body}
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		if successV == nil || resp.StatusCode == http.StatusNoContent {
+			return resp, nil
+		}
+
+		return resp, b.decoder.Decode(resp, successV)
+	}
+
+	statusErr := &client.StatusError{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+	}
+
+	if failureV == nil {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, client.MaxErrorBodySize))
+		if err != nil {
+			return resp, err
+		}
+
+		statusErr.Body = body
+
+		return resp, statusErr
+	}
+
+	// the start of the body is kept for the StatusError as it is decoded
+	head := &headBuffer{n: client.MaxErrorBodySize}
+	br := bufio.NewReader(io.TeeReader(resp.Body, head))
+
+	if _, err := br.Peek(1); err == nil {
+		resp.Body = readCloser{br, resp.Body}
+
+		if err := b.decoder.Decode(resp, failureV); err != nil {
+			return resp, err
+		}
+	} else if !errors.Is(err, io.EOF) {
+		return resp, err
+	}
+
+	statusErr.Body = head.buf
+
+	return resp, statusErr
+}
+
+// readCloser reads from a reader, and closes a closer, e.g. a wrapped
+// response body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// headBuffer keeps the first n bytes written to it.
+type headBuffer struct {
+	buf []byte
+	n   int
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	if room := h.n - len(h.buf); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+
+		h.buf = append(h.buf, p[:room]...)
+	}
+
+	return len(p), nil
+}
+
+// jsonDecoder decodes JSON response bodies, treating empty bodies as
+// nothing to decode.
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(resp *http.Response, v interface{}) error {
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
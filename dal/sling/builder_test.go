@@ -0,0 +1,369 @@
+package sling
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nickhstr/goweb/dal/client"
+	"github.com/nickhstr/goweb/internal/cachetest"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Name string `json:"name"`
+}
+
+type apiError struct {
+	Message string `json:"message"`
+}
+
+func TestBuilderReceive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/1":
+			fmt.Fprint(w, `{"name":"foo"}`)
+		case "/users/2":
+			w.WriteHeader(http.StatusNoContent)
+		case "/large":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"message":"%s"}`, strings.Repeat("x", 2*client.MaxErrorBodySize))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"not found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	b := NewBuilderWithClient(client.New().SetHTTPClient(srv.Client()).SetSkipCache(true)).Base(srv.URL + "/")
+
+	t.Run("should decode success bodies", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var (
+			u      user
+			failed apiError
+		)
+
+		resp, err := b.New().Get("users/1").Receive(&u, &failed)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Equal(user{"foo"}, u)
+		assert.Equal(apiError{}, failed)
+	})
+
+	t.Run("should not decode empty responses", func(t *testing.T) {
+		var u user
+
+		_, err := b.New().Get("users/2").ReceiveSuccess(&u)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should decode error bodies", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var (
+			u      user
+			failed apiError
+		)
+
+		_, err := b.New().Get("users/3").Receive(&u, &failed)
+		assert.Equal(apiError{"not found"}, failed)
+		assert.Equal(user{}, u)
+
+		var statusErr *client.StatusError
+		if assert.True(errors.As(err, &statusErr)) {
+			assert.Equal(http.StatusNotFound, statusErr.StatusCode)
+			assert.Equal(srv.URL+"/users/3", statusErr.URL)
+			assert.Equal(`{"message":"not found"}`, string(statusErr.Body))
+		}
+	})
+
+	t.Run("should truncate error bodies", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, failed := range []interface{}{nil, &apiError{}} {
+			_, err := b.New().Get("large").Receive(nil, failed)
+
+			var statusErr *client.StatusError
+			if assert.True(errors.As(err, &statusErr)) {
+				assert.Len(statusErr.Body, client.MaxErrorBodySize)
+			}
+		}
+	})
+
+	t.Run("should limit response size", func(t *testing.T) {
+		lb := NewBuilderWithClient(client.New().SetHTTPClient(srv.Client()).SetSkipCache(true).SetMaxResponseSize(5)).Base(srv.URL + "/")
+
+		var u user
+		_, err := lb.Get("users/1").ReceiveSuccess(&u)
+		assert.True(t, errors.Is(err, client.ErrResponseTooLarge))
+	})
+}
+
+func TestBuilderCacheOptions(t *testing.T) {
+	var hits int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=900")
+		fmt.Fprintf(w, `{"name":"%d"}`, n)
+	}))
+	defer srv.Close()
+
+	c := client.New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+	base := NewBuilderWithClient(c).Base(srv.URL)
+
+	get := func(b *Builder) string {
+		var u user
+		if _, err := b.ReceiveSuccess(&u); err != nil {
+			t.Fatal(err)
+		}
+
+		return u.Name
+	}
+
+	assert := assert.New(t)
+	assert.Equal("1", get(base.New().SkipCache()))
+	assert.Equal("2", get(base.New()))
+	assert.Equal("2", get(base.New()))
+	assert.Equal("3", get(base.New().ForceRefresh()))
+	assert.Equal("3", get(base.New()))
+
+	// the TTL expires immediately, so the response is never served
+	assert.Equal("4", get(base.New().Path("ttl").TTL(time.Nanosecond)))
+	assert.Equal("5", get(base.New().Path("ttl").TTL(time.Nanosecond)))
+}
+
+func TestPages(t *testing.T) {
+	pages := [][]user{
+		{{"a"}, {"b"}},
+		{{"c"}},
+		{{"d"}},
+	}
+
+	t.Run("should follow Link headers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if n < len(pages)-1 {
+				w.Header().Set("Link", fmt.Sprintf(`<%s/users?page=%d>; rel="next", </users?page=0>; rel="first"`, srv.URL, n+1))
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, toJSON(pages[n]))
+		}))
+		defer srv.Close()
+
+		b := NewBuilderWithClient(client.New().SetHTTPClient(srv.Client())).Base(srv.URL).Get("/users")
+		it := b.Pages(LinkNext)
+
+		var names []string
+
+		for {
+			var page []user
+			if !it.Next(&page) {
+				break
+			}
+
+			for _, u := range page {
+				names = append(names, u.Name)
+			}
+		}
+
+		assert.Nil(it.Err())
+		assert.Equal([]string{"a", "b", "c", "d"}, names)
+		assert.Equal(srv.URL+"/users?page=2", it.Response().Request.URL.String())
+	})
+
+	t.Run("should follow cursors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+
+			next := ""
+			if n < len(pages)-1 {
+				next = strconv.Itoa(n + 1)
+			}
+
+			fmt.Fprintf(w, `{"users":%s,"next":%q}`, toJSON(pages[n]), next)
+		}))
+		defer srv.Close()
+
+		type page struct {
+			Users []user `json:"users"`
+			Next  string `json:"next"`
+		}
+
+		b := NewBuilderWithClient(client.New().SetHTTPClient(srv.Client())).Base(srv.URL).Get("/users?limit=2")
+		it := b.Pages(Cursor("cursor", func(p interface{}) string {
+			return p.(*page).Next
+		}))
+
+		var names []string
+
+		for {
+			var p page
+			if !it.Next(&p) {
+				break
+			}
+
+			for _, u := range p.Users {
+				names = append(names, u.Name)
+			}
+		}
+
+		assert.Nil(it.Err())
+		assert.Equal([]string{"a", "b", "c", "d"}, names)
+		assert.Equal("2", it.Response().Request.URL.Query().Get("limit"))
+	})
+
+	t.Run("should stop at pages already fetched", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", `</users>; rel="next"`)
+			fmt.Fprint(w, toJSON(pages[0]))
+		}))
+		defer srv.Close()
+
+		it := NewBuilderWithClient(client.New().SetHTTPClient(srv.Client())).Base(srv.URL).Get("/users").Pages(LinkNext)
+
+		var page []user
+		assert.True(it.Next(&page))
+		assert.False(it.Next(&page))
+		assert.Nil(it.Err())
+	})
+
+	t.Run("should cache pages under their own keys", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if n < len(pages)-1 {
+				w.Header().Set("Link", fmt.Sprintf(`</users?page=%d>; rel="next"`, n+1))
+			}
+
+			w.Header().Set("Cache-Control", "max-age=60")
+			fmt.Fprint(w, toJSON(pages[n]))
+		}))
+		defer srv.Close()
+
+		c := client.New().SetHTTPClient(srv.Client()).SetCacher(cachetest.NewMemory())
+		b := NewBuilderWithClient(c).Base(srv.URL).Get("/users").CacheKey("users")
+
+		for i := 0; i < 2; i++ {
+			it := b.New().Pages(LinkNext)
+
+			var names []string
+
+			for {
+				var page []user
+				if !it.Next(&page) {
+					break
+				}
+
+				for _, u := range page {
+					names = append(names, u.Name)
+				}
+			}
+
+			assert.Nil(it.Err())
+			assert.Equal([]string{"a", "b", "c", "d"}, names)
+		}
+	})
+
+	t.Run("should not send headers to other origins", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var auth []string
+
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth = append(auth, r.Header.Get("Authorization"))
+			fmt.Fprint(w, toJSON(pages[2]))
+		}))
+		defer other.Close()
+
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth = append(auth, r.Header.Get("Authorization"))
+
+			if r.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", fmt.Sprintf(`<%s/users?page=1>; rel="next"`, srv.URL))
+			} else {
+				w.Header().Set("Link", fmt.Sprintf(`<%s/users?page=2>; rel="next"`, other.URL))
+			}
+
+			fmt.Fprint(w, toJSON(pages[0]))
+		}))
+		defer srv.Close()
+
+		it := NewBuilderWithClient(client.New()).Base(srv.URL).Get("/users").Set("Authorization", "secret").Pages(LinkNext)
+
+		var page []user
+		for it.Next(&page) {
+		}
+
+		assert.Nil(it.Err())
+		assert.Equal([]string{"secret", "secret", ""}, auth)
+	})
+
+	t.Run("should stop on errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := httptest.NewServer(http.NotFoundHandler())
+		defer srv.Close()
+
+		it := NewBuilderWithClient(client.New().SetHTTPClient(srv.Client())).Base(srv.URL).Pages(LinkNext)
+
+		var page []user
+		assert.False(it.Next(&page))
+		assert.False(it.Next(&page))
+
+		var statusErr *client.StatusError
+		assert.True(errors.As(it.Err(), &statusErr))
+	})
+}
+
+func TestLinkNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     string
+		expected string
+	}{
+		{"no header", "", ""},
+		{"no next", `<https://foo.com?page=1>; rel="prev"`, ""},
+		{"absolute", `<https://foo.com?page=1>; rel="prev", <https://foo.com?page=3>; rel="next"`, "https://foo.com?page=3"},
+		{"relative", `</users?page=3>; rel=next`, "https://foo.com/users?page=3"},
+		{"multiple rels", `<https://foo.com?page=3>; rel="next last"`, "https://foo.com?page=3"},
+		{"malformed", `https://foo.com?page=3; rel="next"`, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://foo.com/users?page=2", nil)
+			resp := &http.Response{Header: http.Header{}, Request: req}
+
+			if test.link != "" {
+				resp.Header.Set("Link", test.link)
+			}
+
+			next, ok := LinkNext(resp, nil)
+			assert.Equal(t, test.expected != "", ok)
+
+			if ok {
+				assert.Equal(t, test.expected, next.String())
+			}
+		})
+	}
+}
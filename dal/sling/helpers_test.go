@@ -0,0 +1,11 @@
+package sling
+
+import (
+	"encoding/json"
+)
+
+// toJSON returns the JSON encoding of v.
+func toJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,190 @@
+package sling
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nickhstr/goweb/dal/client"
+)
+
+// Paginator returns the URL of the page following the response, and its
+// decoded page, or false if it is the last page.
+type Paginator func(resp *http.Response, page interface{}) (*url.URL, bool)
+
+// LinkNext is a Paginator which follows the "next" relation of the
+// response's Link header (RFC 8288), as used by e.g. GitHub's API.
+func LinkNext(resp *http.Response, page interface{}) (*url.URL, bool) {
+	for _, link := range resp.Header.Values("Link") {
+		for _, l := range strings.Split(link, ",") {
+			target, rels, ok := parseLink(l)
+			if !ok || !hasRel(rels, "next") {
+				continue
+			}
+
+			next, err := url.Parse(target)
+			if err != nil {
+				return nil, false
+			}
+
+			if resp.Request != nil {
+				next = resp.Request.URL.ResolveReference(next)
+			}
+
+			return next, true
+		}
+	}
+
+	return nil, false
+}
+
+// parseLink parses a link-value, e.g. `<https://foo.com?page=2>; rel="next"`,
+// into its target and relation types.
+func parseLink(link string) (string, string, bool) {
+	parts := strings.Split(link, ";")
+
+	target := strings.TrimSpace(parts[0])
+	if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+		return "", "", false
+	}
+
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+			return target[1 : len(target)-1], strings.Trim(strings.TrimSpace(kv[1]), `"`), true
+		}
+	}
+
+	return "", "", false
+}
+
+// hasRel reports whether the space separated relation types include rel.
+func hasRel(rels, rel string) bool {
+	for _, r := range strings.Fields(rels) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Cursor returns a Paginator which requests the next page by setting the
+// query parameter param to the cursor returned by next, for the decoded
+// page. An empty cursor marks the last page.
+func Cursor(param string, next func(page interface{}) string) Paginator {
+	return func(resp *http.Response, page interface{}) (*url.URL, bool) {
+		cursor := next(page)
+		if cursor == "" || resp.Request == nil {
+			return nil, false
+		}
+
+		u := *resp.Request.URL
+		q := u.Query()
+		q.Set(param, cursor)
+		u.RawQuery = q.Encode()
+
+		return &u, true
+	}
+}
+
+// Pages iterates over the pages of a list endpoint:
+//
+//	pages := b.Get("users").Pages(sling.LinkNext)
+//	for {
+//		var users []User
+//		if !pages.Next(&users) {
+//			break
+//		}
+//		...
+//	}
+//	if err := pages.Err(); err != nil {
+//		...
+//	}
+type Pages struct {
+	b       *Builder
+	next    Paginator
+	url     *url.URL
+	fetched map[string]bool
+	done    bool
+	resp    *http.Response
+	err     error
+}
+
+// Pages returns an iterator over the pages of the Builder's request, the
+// first of which is the request itself. Iteration stops at a page whose
+// next page was already fetched, so that a looping server does not loop
+// the iterator.
+// Later pages are cached under keys of their own URLs, rather than the
+// Builder's CacheKey, and are requested without the Builder's headers if
+// on another origin than the first.
+func (b *Builder) Pages(next Paginator) *Pages {
+	return &Pages{b: b, next: next, fetched: map[string]bool{}}
+}
+
+// Next fetches the next page, decoding it into page. It returns false once
+// there are no more pages, or a request failed; see Err.
+func (p *Pages) Next(page interface{}) bool {
+	if p.done {
+		return false
+	}
+
+	req, err := p.b.Request()
+	if err != nil {
+		p.fail(err)
+		return false
+	}
+
+	if p.url != nil {
+		// the Builder's cache key, if any, is that of the first page
+		req = req.WithContext(client.WithCacheKey(req.Context(), ""))
+
+		// nor are the Builder's headers, which may hold credentials, sent
+		// to another origin
+		if !sameOrigin(req.URL, p.url) {
+			req.Header = make(http.Header)
+		}
+
+		req.URL = p.url
+		req.Host = ""
+	}
+
+	resp, err := p.b.Do(req, page, nil)
+	if err != nil {
+		p.fail(err)
+		return false
+	}
+
+	p.resp = resp
+	p.fetched[req.URL.String()] = true
+
+	// paginators resolve the next page against the request actually sent
+	resp.Request = req
+	p.url, p.done = nil, true
+
+	if next, ok := p.next(resp, page); ok && !p.fetched[next.String()] {
+		p.url, p.done = next, false
+	}
+
+	return true
+}
+
+// sameOrigin reports whether the URLs have the same scheme and host.
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host)
+}
+
+func (p *Pages) fail(err error) {
+	p.err = err
+	p.done = true
+}
+
+// Response returns the response of the last page fetched.
+func (p *Pages) Response() *http.Response {
+	return p.resp
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (p *Pages) Err() error {
+	return p.err
+}
@@ -9,6 +9,9 @@ var dalClient = client.New()
 
 // New returns a Sling instance, using the default DAL Client as
 // its Doer.
+// As the default Client is shared, caching is best controlled per
+// request, with the request's context (see client.WithTTL,
+// client.WithCacheKey and client.WithForceRefresh), or with a Builder.
 func New() *sling.Sling {
 	return sling.New().Doer(dalClient)
 }
@@ -2,12 +2,17 @@ package mongodb
 
 import (
 	"context"
+
+	"github.com/nickhstr/goweb/tracing"
 )
 
 // Aggregate uses an aggregation pipeline to process
 // data records and decode into a results data structure.
 // Results must be a pointer to a slice.
-func (db *DB) Aggregate(ctx context.Context, collName string, pipeline interface{}, results interface{}) error {
+func (db *DB) Aggregate(ctx context.Context, collName string, pipeline interface{}, results interface{}) (err error) {
+	ctx, span := startSpan(ctx, "aggregate", collName)
+	defer func() { tracing.EndSpan(span, err) }()
+
 	coll := db.Collection(collName)
 
 	cursor, err := coll.Aggregate(ctx, pipeline)
@@ -3,12 +3,17 @@ package mongodb
 import (
 	"context"
 	"errors"
+
+	"github.com/nickhstr/goweb/tracing"
 )
 
 var ErrBadDelete = errors.New("mongodb: document does not exist")
 
 // DeleteOne attempts to delete a document by ID.
-func (db *DB) DeleteOne(ctx context.Context, collName, id string) error {
+func (db *DB) DeleteOne(ctx context.Context, collName, id string) (err error) {
+	ctx, span := startSpan(ctx, "delete", collName)
+	defer func() { tracing.EndSpan(span, err) }()
+
 	log := log.With().
 		Str("collection", collName).
 		Str("id", id).
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/nickhstr/goweb/cache"
+	"github.com/nickhstr/goweb/tracing"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -40,11 +41,11 @@ func (db *DB) FindAll(ctx context.Context, collName string, start, limit int64,
 // limit can be zero (to get all matched documents), or some integer
 // less than or equal to the matched document count.
 // Note, results must be a pointer to a slice.
-func (db *DB) FindMany(ctx context.Context, collName string, start, limit int64, filter interface{}, results interface{}) error {
-	var (
-		count int64
-		err   error
-	)
+func (db *DB) FindMany(ctx context.Context, collName string, start, limit int64, filter interface{}, results interface{}) (err error) {
+	var count int64
+
+	ctx, span := startSpan(ctx, "find", collName)
+	defer func() { tracing.EndSpan(span, err) }()
 
 	coll := db.Collection(collName)
 
@@ -91,8 +92,9 @@ func (db *DB) FindMany(ctx context.Context, collName string, start, limit int64,
 // Note, result must be a pointer.
 // By default, a cache is used; this can be bypassed by adding
 // to the context a "no cache" flag, using cache.ContextWithNoCache.
-func (db *DB) FindOne(ctx context.Context, collName string, filter interface{}, result interface{}) error {
-	var err error
+func (db *DB) FindOne(ctx context.Context, collName string, filter interface{}, result interface{}) (err error) {
+	ctx, span := startSpan(ctx, "findOne", collName)
+	defer func() { tracing.EndSpan(span, err) }()
 
 	cacheKey, err := db.CacheKey(collName, filter)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/nickhstr/goweb/tracing"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -12,8 +13,9 @@ var ErrInsertConflict = errors.New("mongodb: insert failed, document exists")
 
 // InsertOne tries to insert the given data into the collection.
 // If data is already stored under the same ID, an error is returned.
-func (db *DB) InsertOne(ctx context.Context, collName, id string, data interface{}) error {
-	var err error
+func (db *DB) InsertOne(ctx context.Context, collName, id string, data interface{}) (err error) {
+	ctx, span := startSpan(ctx, "insert", collName)
+	defer func() { tracing.EndSpan(span, err) }()
 
 	log := log.With().
 		Str("collection", collName).
@@ -11,9 +11,12 @@ import (
 	"github.com/nickhstr/goweb/cache"
 	"github.com/nickhstr/goweb/logger"
 	"github.com/nickhstr/goweb/mongodb"
+	"github.com/nickhstr/goweb/tracing"
 	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var log = logger.New("mongodb")
@@ -170,6 +173,20 @@ func cacheKey(prefix, collName string, filter interface{}, args ...string) (stri
 	return key, err
 }
 
+// startSpan starts a client span for a collection operation.
+func startSpan(ctx context.Context, operation, collName string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(
+		ctx,
+		"mongodb "+collName+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBOperationKey.String(operation),
+			semconv.DBMongoDBCollectionKey.String(collName),
+		),
+	)
+}
+
 // IDFilter returns a filter for querying by ID.
 func (db *DB) IDFilter(id string) bson.M {
 	return bson.M{"_id": id}
@@ -3,12 +3,14 @@ package mongodb
 import (
 	"context"
 
+	"github.com/nickhstr/goweb/tracing"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // ReplaceByID updates an collection's document by replacing it.
-func (db *DB) ReplaceByID(ctx context.Context, collName, id string, data interface{}) error {
-	var err error
+func (db *DB) ReplaceByID(ctx context.Context, collName, id string, data interface{}) (err error) {
+	ctx, span := startSpan(ctx, "replace", collName)
+	defer func() { tracing.EndSpan(span, err) }()
 
 	log := log.With().
 		Str("collection", collName).
@@ -0,0 +1,293 @@
+package dnscache
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Rotation is how a host's addresses are ordered between dials.
+type Rotation int
+
+const (
+	// RotateRoundRobin starts each dial of a host at its next address.
+	RotateRoundRobin Rotation = iota
+	// RotateRandom shuffles a host's addresses for each dial.
+	RotateRandom
+	// RotateNone keeps addresses in the order they were looked up.
+	RotateNone
+)
+
+// DialContext dials the address, resolving its host with the Resolver.
+// It may be used as an http.Transport's DialContext.
+func (r *Resolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return r.dialContext(defaultDialer().DialContext)(ctx, network, addr)
+}
+
+// Attach makes the transport resolve hosts with the Resolver, wrapping the
+// transport's DialContext, which then dials resolved IPs.
+func (r *Resolver) Attach(t *http.Transport) {
+	dial := t.DialContext
+	if dial == nil {
+		dial = defaultDialer().DialContext
+	}
+
+	t.DialContext = r.dialContext(dial)
+}
+
+// dialFunc dials a network address.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialContext returns a dialFunc resolving hosts with the Resolver, and
+// racing connections to their IPs with dial.
+func (r *Resolver) dialContext(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := r.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		ips = r.order(host, filterNetwork(network, ips))
+		if len(ips) == 0 {
+			return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+		}
+
+		return r.dialParallel(ctx, dial, network, ips, port)
+	}
+}
+
+// attempt is the result of a connection attempt.
+type attempt struct {
+	ip   string
+	conn net.Conn
+	err  error
+}
+
+// dialParallel connects to the first IP to accept, starting an attempt
+// for each IP in turn, once the previous attempt failed or ran for the
+// fallback delay.
+func (r *Resolver) dialParallel(ctx context.Context, dial dialFunc, network string, ips []string, port string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		results  = make(chan attempt, len(ips))
+		started  int
+		pending  int
+		firstErr error
+	)
+
+	start := func() {
+		ip := ips[started]
+		started++
+		pending++
+
+		go func() {
+			actx, acancel := context.WithTimeout(ctx, r.opts.AttemptTimeout)
+			defer acancel()
+
+			conn, err := dial(actx, network, net.JoinHostPort(ip, port))
+			results <- attempt{ip, conn, err}
+		}()
+	}
+
+	start()
+
+	fallback := time.NewTimer(0)
+	defer fallback.Stop()
+
+	resetTimer(fallback, r.opts.FallbackDelay)
+
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+
+			if res.err == nil {
+				r.promote(res.ip)
+
+				// close the connections of attempts which also succeed
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if res := <-results; res.conn != nil {
+							res.conn.Close()
+						}
+					}
+				}(pending)
+
+				return res.conn, nil
+			}
+
+			// attempts canceled by the caller are not the address' fault
+			if ctx.Err() == nil {
+				r.demote(res.ip)
+			}
+
+			if firstErr == nil {
+				firstErr = res.err
+			}
+
+			if started < len(ips) && ctx.Err() == nil {
+				start()
+				resetTimer(fallback, r.opts.FallbackDelay)
+			}
+
+		case <-fallback.C:
+			if started < len(ips) {
+				start()
+				resetTimer(fallback, r.opts.FallbackDelay)
+			}
+		}
+	}
+
+	return nil, firstErr
+}
+
+// resetTimer resets the timer to fire after d, or never if d is negative.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+
+	if d >= 0 {
+		t.Reset(d)
+	}
+}
+
+// order returns the IPs in the order to attempt them: rotated, with
+// recently failed IPs last, and interleaving IPv6 and IPv4 addresses,
+// starting with IPv6 (RFC 8305).
+func (r *Resolver) order(host string, ips []string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ordered := append([]string(nil), ips...)
+
+	dials := 0
+	if e, ok := r.entries[host]; ok {
+		dials = e.dials
+		e.dials++
+	}
+
+	switch r.opts.Rotation {
+	case RotateRoundRobin:
+		n := dials % len(ordered)
+		ordered = append(ordered[n:], ordered[:n]...)
+	case RotateRandom:
+		rand.Shuffle(len(ordered), func(i, j int) {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		})
+	}
+
+	now := time.Now()
+	demoted := func(ip string) bool {
+		failed, ok := r.demoted[ip]
+		return ok && now.Sub(failed) < r.opts.DemotionPeriod
+	}
+
+	var healthy, failed []string
+
+	for _, ip := range ordered {
+		if demoted(ip) {
+			failed = append(failed, ip)
+		} else {
+			healthy = append(healthy, ip)
+		}
+	}
+
+	// interleaved separately, so that a demoted IPv6 address is never
+	// attempted before a healthy IPv4 address
+	return append(interleave(healthy), interleave(failed)...)
+}
+
+// interleave alternates the IPv6 and IPv4 addresses, keeping their
+// order, starting with IPv6.
+func interleave(ips []string) []string {
+	var v6, v4 []string
+
+	for _, ip := range ips {
+		if isIPv4(ip) {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	out := make([]string, 0, len(ips))
+
+	for len(v6) > 0 || len(v4) > 0 {
+		if len(v6) > 0 {
+			out = append(out, v6[0])
+			v6 = v6[1:]
+		}
+
+		if len(v4) > 0 {
+			out = append(out, v4[0])
+			v4 = v4[1:]
+		}
+	}
+
+	return out
+}
+
+// filterNetwork returns the IPs usable with the network, e.g. only IPv4
+// addresses for "tcp4".
+func filterNetwork(network string, ips []string) []string {
+	var want func(string) bool
+
+	switch network {
+	case "tcp4", "udp4":
+		want = isIPv4
+	case "tcp6", "udp6":
+		want = func(ip string) bool { return !isIPv4(ip) }
+	default:
+		return ips
+	}
+
+	var out []string
+
+	for _, ip := range ips {
+		if want(ip) {
+			out = append(out, ip)
+		}
+	}
+
+	return out
+}
+
+func isIPv4(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.To4() != nil
+}
+
+// demote attempts the IP after others, for the demotion period.
+func (r *Resolver) demote(ip string) {
+	r.mu.Lock()
+	r.demoted[ip] = time.Now()
+	r.mu.Unlock()
+}
+
+// promote ends any demotion of the IP.
+func (r *Resolver) promote(ip string) {
+	r.mu.Lock()
+	delete(r.demoted, ip)
+	r.mu.Unlock()
+}
+
+// defaultDialer returns the dialer used by http.DefaultTransport.
+func defaultDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+}
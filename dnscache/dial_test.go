@@ -0,0 +1,192 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConn is a net.Conn to an address.
+type fakeConn struct {
+	net.Conn
+	addr string
+}
+
+// fakeDial connects to addresses immediately, fails for those in failed,
+// and hangs for those in hung until the attempt is canceled.
+func fakeDial(failed, hung map[string]bool) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, _ := net.SplitHostPort(addr)
+
+		switch {
+		case failed[host]:
+			return nil, errors.New("connection refused")
+		case hung[host]:
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+
+		return &fakeConn{addr: addr}, nil
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	tests := []struct {
+		name     string
+		ips      []string
+		expected []string
+	}{
+		{"IPv4 only", []string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.1", "10.0.0.2"}},
+		{"IPv6 only", []string{"::1", "::2"}, []string{"::1", "::2"}},
+		{
+			"mixed",
+			[]string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "::1", "::2"},
+			[]string{"::1", "10.0.0.1", "::2", "10.0.0.2", "10.0.0.3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, interleave(test.ips))
+		})
+	}
+}
+
+func TestFilterNetwork(t *testing.T) {
+	ips := []string{"10.0.0.1", "::1", "::ffff:10.0.0.2"}
+
+	assert.Equal(t, ips, filterNetwork("tcp", ips))
+	assert.Equal(t, []string{"10.0.0.1", "::ffff:10.0.0.2"}, filterNetwork("tcp4", ips))
+	assert.Equal(t, []string{"::1"}, filterNetwork("tcp6", ips))
+}
+
+func TestResolverOrder(t *testing.T) {
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	u := &fakeUpstream{hosts: map[string][]string{"foo.com": ips}}
+
+	t.Run("should rotate addresses", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newTestResolver(t, Options{}, u)
+		_, _ = r.LookupHost(context.Background(), "foo.com")
+
+		assert.Equal([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, r.order("foo.com", ips))
+		assert.Equal([]string{"10.0.0.2", "10.0.0.3", "10.0.0.1"}, r.order("foo.com", ips))
+		assert.Equal([]string{"10.0.0.3", "10.0.0.1", "10.0.0.2"}, r.order("foo.com", ips))
+		assert.Equal([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, ips)
+	})
+
+	t.Run("should not rotate addresses", func(t *testing.T) {
+		r := newTestResolver(t, Options{Rotation: RotateNone}, u)
+		_, _ = r.LookupHost(context.Background(), "foo.com")
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, ips, r.order("foo.com", ips))
+		}
+	})
+
+	t.Run("should shuffle addresses", func(t *testing.T) {
+		r := newTestResolver(t, Options{Rotation: RotateRandom}, u)
+		assert.ElementsMatch(t, ips, r.order("foo.com", ips))
+	})
+
+	t.Run("should attempt demoted addresses last", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newTestResolver(t, Options{Rotation: RotateNone, DemotionPeriod: time.Minute}, u)
+
+		r.demote("10.0.0.1")
+		assert.Equal([]string{"10.0.0.2", "10.0.0.3", "10.0.0.1"}, r.order("foo.com", ips))
+
+		r.mu.Lock()
+		r.demoted["10.0.0.1"] = time.Now().Add(-2 * time.Minute)
+		r.mu.Unlock()
+
+		assert.Equal(ips, r.order("foo.com", ips))
+
+		r.demote("10.0.0.2")
+		r.promote("10.0.0.2")
+		assert.Equal(ips, r.order("foo.com", ips))
+	})
+
+	t.Run("should attempt demoted addresses of either family last", func(t *testing.T) {
+		assert := assert.New(t)
+		mixed := []string{"::1", "::2", "10.0.0.1", "10.0.0.2"}
+		r := newTestResolver(t, Options{Rotation: RotateNone, DemotionPeriod: time.Minute}, u)
+
+		r.demote("::1")
+		assert.Equal([]string{"::2", "10.0.0.1", "10.0.0.2", "::1"}, r.order("foo.com", mixed))
+
+		r.demote("::2")
+		assert.Equal([]string{"10.0.0.1", "10.0.0.2", "::1", "::2"}, r.order("foo.com", mixed))
+
+		r.demote("10.0.0.1")
+		assert.Equal([]string{"10.0.0.2", "::1", "10.0.0.1", "::2"}, r.order("foo.com", mixed))
+	})
+}
+
+func TestResolverDialParallel(t *testing.T) {
+	ips := []string{"10.0.0.1", "10.0.0.2"}
+
+	t.Run("should race a slow address", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newTestResolver(t, Options{FallbackDelay: 10 * time.Millisecond}, &fakeUpstream{})
+		start := time.Now()
+
+		conn, err := r.dialParallel(context.Background(), fakeDial(nil, map[string]bool{"10.0.0.1": true}), "tcp", ips, "80")
+		if assert.Nil(err) {
+			assert.Equal("10.0.0.2:80", conn.(*fakeConn).addr)
+		}
+
+		assert.Less(int64(time.Since(start)), int64(time.Second))
+	})
+
+	t.Run("should time out attempts", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newTestResolver(t, Options{FallbackDelay: -1, AttemptTimeout: 10 * time.Millisecond}, &fakeUpstream{})
+
+		conn, err := r.dialParallel(context.Background(), fakeDial(nil, map[string]bool{"10.0.0.1": true}), "tcp", ips, "80")
+		if assert.Nil(err) {
+			assert.Equal("10.0.0.2:80", conn.(*fakeConn).addr)
+		}
+
+		r.mu.Lock()
+		_, demoted := r.demoted["10.0.0.1"]
+		r.mu.Unlock()
+
+		assert.True(demoted)
+	})
+
+	t.Run("should fall back on failures", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newTestResolver(t, Options{FallbackDelay: time.Hour}, &fakeUpstream{})
+
+		conn, err := r.dialParallel(context.Background(), fakeDial(map[string]bool{"10.0.0.1": true}, nil), "tcp", ips, "80")
+		if assert.Nil(err) {
+			assert.Equal("10.0.0.2:80", conn.(*fakeConn).addr)
+		}
+	})
+
+	t.Run("should fail once all addresses fail", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newTestResolver(t, Options{}, &fakeUpstream{})
+
+		_, err := r.dialParallel(context.Background(), fakeDial(map[string]bool{"10.0.0.1": true, "10.0.0.2": true}, nil), "tcp", ips, "80")
+		assert.EqualError(err, "connection refused")
+		assert.Len(r.demoted, 2)
+	})
+
+	t.Run("should not demote addresses when canceled", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newTestResolver(t, Options{}, &fakeUpstream{})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := r.dialParallel(ctx, fakeDial(nil, map[string]bool{"10.0.0.1": true, "10.0.0.2": true}), "tcp", ips, "80")
+		assert.NotNil(err)
+		assert.Empty(r.demoted)
+	})
+}
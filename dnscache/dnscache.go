@@ -1,4 +1,16 @@
 // Package dnscache exports DNS caching utilities for http.DialContexts.
+//
+// A Resolver caches lookups, and is attached to any http.Transport:
+//
+//	r := dnscache.NewResolver(dnscache.Options{})
+//	defer r.Stop()
+//
+//	t := &http.Transport{}
+//	r.Attach(t)
+//
+// For local development and tests, hosts may be given static addresses with
+// Options.Hosts or the DNSCACHE_HOSTS config variable, and lookups served by
+// a fake Options.Upstream.
 package dnscache
 
 import (
@@ -8,83 +20,64 @@ import (
 	"sync"
 	"time"
 
-	"github.com/rs/dnscache"
+	"github.com/nickhstr/goweb/logger"
 )
 
-var mutex = &sync.Mutex{}
+var (
+	log             = logger.New("dnscache")
+	mutex           = &sync.Mutex{}
+	defaultResolver *Resolver
+)
 
-// Disable resets the default dial context back to http.Transport's DialContext.
+// Disable resets the default dial context back to http.Transport's DialContext,
+// and stops the Resolver started by Enable.
+//
+// Deprecated: attach a Resolver to a Transport with Resolver.Attach instead.
 func Disable() {
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	// The default DialContext used by http.DefaultTransport
-	defaultDialContext := (&net.Dialer{
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
-		DualStack: true,
-	}).DialContext
-	http.DefaultTransport.(*http.Transport).DialContext = defaultDialContext
+	if defaultResolver != nil {
+		defaultResolver.Stop()
+		defaultResolver = nil
+	}
+
+	http.DefaultTransport.(*http.Transport).DialContext = defaultDialer().DialContext
 }
 
 // Enable adds caching to DNS lookups, performed by the standard library's http.DefaultTransport.
 // TTL in this case doesn't truly mean TTL for an address; rather, it determines the number of
-// seconds to use for the cache refresh interval.
+// seconds for which lookups are cached.
+//
+// Deprecated: attach a Resolver to a Transport with Resolver.Attach instead.
 func Enable(ttl int) {
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	dc := DialContext(ttl)
-	http.DefaultTransport.(*http.Transport).DialContext = dc
+	if defaultResolver != nil {
+		defaultResolver.Stop()
+	}
+
+	defaultResolver = NewResolver(legacyOptions(ttl))
+	http.DefaultTransport.(*http.Transport).DialContext = defaultResolver.DialContext
 }
 
 // DialContext returns an http.DialContext with DNS caching.
-// Cached DNS entries are refreshed by a ticker, with the given TTL as the
-// number of seconds to wait before refreshing the cache.
+// Lookups are cached for the given TTL, in seconds.
+//
+// Deprecated: the returned DialContext's Resolver can never be stopped;
+// use NewResolver and Resolver.DialContext instead.
 func DialContext(ttl int) func(context.Context, string, string) (net.Conn, error) {
-	r := new(dnscache.Resolver)
-
-	// Run refresh job in background
-	go func() {
-		t := time.NewTicker(time.Duration(ttl) * time.Second)
-		defer t.Stop()
-
-		for range t.C {
-			// Use true to refresh addresses not used since the last refresh
-			r.Refresh(true)
-		}
-	}()
-
-	return cachedDialContext(r)
+	return NewResolver(legacyOptions(ttl)).DialContext
 }
 
-// cachedDialContext returns a DialContext which caches DNS lookups of HTTP connections.
-func cachedDialContext(r *dnscache.Resolver) func(context.Context, string, string) (net.Conn, error) {
-	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
-		var (
-			conn net.Conn
-			err  error
-		)
-
-		host, port, err := net.SplitHostPort(addr)
-		if err != nil {
-			return nil, err
-		}
-
-		ips, err := r.LookupHost(ctx, host)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, ip := range ips {
-			var dialer net.Dialer
-
-			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
-			if err == nil {
-				break
-			}
-		}
+// legacyOptions returns the Options caching lookups for ttl seconds.
+func legacyOptions(ttl int) Options {
+	d := time.Duration(ttl) * time.Second
 
-		return conn, err
+	return Options{
+		DefaultTTL: d,
+		MinTTL:     d,
+		MaxTTL:     d,
 	}
 }
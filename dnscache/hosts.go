@@ -0,0 +1,62 @@
+package dnscache
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// HostsFromEnv returns the static hosts of the DNSCACHE_HOSTS config
+// variable: comma separated "host=ip" pairs, in which a host may be
+// repeated for several addresses, e.g.
+//
+//	DNSCACHE_HOSTS="api.foo.com=127.0.0.1,api.foo.com=::1,db.foo.com=10.0.0.5"
+func HostsFromEnv() (map[string][]string, error) {
+	return parseHosts(viper.GetString("DNSCACHE_HOSTS"))
+}
+
+// parseHosts parses comma separated "host=ip" pairs.
+func parseHosts(s string) (map[string][]string, error) {
+	hosts := make(map[string][]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("dnscache: invalid host %q", pair)
+		}
+
+		host, ip := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("dnscache: invalid address %q for host %s", ip, host)
+		}
+
+		hosts[host] = append(hosts[host], ip)
+	}
+
+	return hosts, nil
+}
+
+// normalizeHosts returns the hosts keyed by their normalized names.
+func normalizeHosts(hosts map[string][]string) map[string][]string {
+	normalized := make(map[string][]string, len(hosts))
+
+	for host, addrs := range hosts {
+		host = normalizeHost(host)
+		normalized[host] = append(normalized[host], addrs...)
+	}
+
+	return normalized
+}
+
+// normalizeHost returns the host's name in lower case, without any
+// trailing dot.
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,72 @@
+package dnscache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		hosts    string
+		expected map[string][]string
+		err      bool
+	}{
+		{"empty", "", map[string][]string{}, false},
+		{
+			"hosts",
+			"foo.com=127.0.0.1, foo.com=::1,bar.com=10.0.0.1,",
+			map[string][]string{"foo.com": {"127.0.0.1", "::1"}, "bar.com": {"10.0.0.1"}},
+			false,
+		},
+		{"missing address", "foo.com", nil, true},
+		{"missing host", "=127.0.0.1", nil, true},
+		{"invalid address", "foo.com=localhost", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hosts, err := parseHosts(test.hosts)
+			assert.Equal(t, test.err, err != nil)
+			assert.Equal(t, test.expected, hosts)
+		})
+	}
+}
+
+func TestResolverHosts(t *testing.T) {
+	u := &fakeUpstream{hosts: map[string][]string{"foo.com": {"10.0.0.1"}}}
+
+	t.Run("should serve static hosts", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newTestResolver(t, Options{Hosts: map[string][]string{"Foo.com.": {"127.0.0.1"}}}, u)
+
+		for _, host := range []string{"foo.com", "FOO.COM", "foo.com."} {
+			addrs, err := r.LookupHost(context.Background(), host)
+			assert.Nil(err)
+			assert.Equal([]string{"127.0.0.1"}, addrs)
+		}
+
+		assert.Equal(0, u.count())
+	})
+
+	t.Run("should read static hosts from config", func(t *testing.T) {
+		assert := assert.New(t)
+
+		viper.Set("DNSCACHE_HOSTS", "foo.com=127.0.0.2")
+		defer viper.Set("DNSCACHE_HOSTS", "")
+
+		r := newTestResolver(t, Options{}, u)
+		addrs, err := r.LookupHost(context.Background(), "foo.com")
+		assert.Nil(err)
+		assert.Equal([]string{"127.0.0.2"}, addrs)
+
+		// hosts set in code replace those of the config
+		r = newTestResolver(t, Options{Hosts: map[string][]string{}}, u)
+		addrs, err = r.LookupHost(context.Background(), "foo.com")
+		assert.Nil(err)
+		assert.Equal([]string{"10.0.0.1"}, addrs)
+	})
+}
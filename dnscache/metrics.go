@@ -0,0 +1,31 @@
+package dnscache
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	lookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dnscache_lookups_total",
+		Help: "Total number of host lookups by DNS cache resolvers.",
+	}, []string{"host", "result"})
+
+	refreshErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dnscache_refresh_errors_total",
+		Help: "Total number of failed host lookups by DNS cache resolvers, excluding hosts which do not exist.",
+	}, []string{"host"})
+)
+
+func init() {
+	prometheus.MustRegister(lookups, refreshErrors)
+}
+
+// Results of lookups, used as the "result" label.
+const (
+	resultHit         = "hit"
+	resultMiss        = "miss"
+	resultNegativeHit = "negative_hit"
+	resultStatic      = "static"
+)
+
+func observeLookup(host, result string) {
+	lookups.WithLabelValues(host, result).Inc()
+}
@@ -0,0 +1,242 @@
+package dnscache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxUDPSize is the largest DNS message read over UDP.
+const maxUDPSize = 4096
+
+// nameservers looks up hosts by querying nameservers directly, reporting
+// the smallest TTL of the records answered.
+type nameservers struct {
+	servers []string
+}
+
+func newNameservers(servers []string) *nameservers {
+	ns := &nameservers{}
+
+	for _, s := range servers {
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(s, "53")
+		}
+
+		ns.servers = append(ns.servers, s)
+	}
+
+	return ns
+}
+
+// LookupHost looks up the host's IPv4 and IPv6 addresses.
+func (ns *nameservers) LookupHost(ctx context.Context, host string) ([]string, time.Duration, error) {
+	name, err := dnsmessage.NewName(fqdn(host))
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+	}
+
+	var (
+		addrs []string
+		ttl   time.Duration
+	)
+
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, foundTTL, err := ns.query(ctx, name, qtype)
+		if err != nil {
+			return nil, 0, &net.DNSError{Err: err.Error(), Name: host, IsTemporary: true}
+		}
+
+		if len(found) > 0 && (ttl == 0 || foundTTL < ttl) {
+			ttl = foundTTL
+		}
+
+		addrs = append(addrs, found...)
+	}
+
+	if len(addrs) == 0 {
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addrs, ttl, nil
+}
+
+// query asks the nameservers, in turn, for the name's records of the type,
+// returning their addresses and smallest TTL.
+func (ns *nameservers) query(ctx context.Context, name dnsmessage.Name, qtype dnsmessage.Type) ([]string, time.Duration, error) {
+	var lastErr error
+
+	for _, server := range ns.servers {
+		msg, err := exchange(ctx, server, name, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		switch msg.RCode {
+		case dnsmessage.RCodeSuccess:
+		case dnsmessage.RCodeNameError:
+			return nil, 0, nil
+		default:
+			lastErr = fmt.Errorf("server %s replied %s", server, msg.RCode)
+			continue
+		}
+
+		var (
+			addrs []string
+			ttl   time.Duration
+		)
+
+		for _, answer := range msg.Answers {
+			// CNAME records count towards the TTL, as the addresses are only
+			// valid while they are
+			if t := time.Duration(answer.Header.TTL) * time.Second; ttl == 0 || t < ttl {
+				ttl = t
+			}
+
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, net.IP(body.AAAA[:]).String())
+			}
+		}
+
+		return addrs, ttl, nil
+	}
+
+	return nil, 0, lastErr
+}
+
+// exchange sends a query to the server over UDP, retrying over TCP if the
+// response is truncated.
+// Queries have random IDs, and only responses with the query's ID and
+// question are accepted, so that spoofed responses are hard to forge.
+func exchange(ctx context.Context, server string, name dnsmessage.Name, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+
+	q := &dnsmessage.Message{
+		Header: dnsmessage.Header{ID: binary.BigEndian.Uint16(b[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+
+	query, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := exchangeOver(ctx, "udp", server, query, q)
+	if err == nil && msg.Truncated {
+		msg, err = exchangeOver(ctx, "tcp", server, query, q)
+	}
+
+	return msg, err
+}
+
+// exchangeOver sends the packed query to the server over the network, and
+// reads the response to it.
+// Over UDP, which anyone may send to the socket, responses which do not
+// answer the query are ignored, until one does or the context is done.
+func exchangeOver(ctx context.Context, network, server string, query []byte, q *dnsmessage.Message) (*dnsmessage.Message, error) {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		// messages over TCP are prefixed with their length
+		prefixed := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(prefixed, uint16(len(query)))
+		copy(prefixed[2:], query)
+
+		if _, err := conn.Write(prefixed); err != nil {
+			return nil, err
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+
+		resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(resp); err != nil {
+			return nil, err
+		}
+
+		if !answers(&msg, q) {
+			return nil, errors.New("invalid response")
+		}
+
+		return &msg, nil
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, maxUDPSize)
+
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(resp[:n]); err != nil {
+			continue
+		}
+
+		if answers(&msg, q) {
+			return &msg, nil
+		}
+	}
+}
+
+// answers reports whether the message is a response to the query, having
+// its ID and question.
+func answers(msg, q *dnsmessage.Message) bool {
+	if !msg.Response || msg.ID != q.ID || len(msg.Questions) != 1 {
+		return false
+	}
+
+	got, want := msg.Questions[0], q.Questions[0]
+
+	return got.Type == want.Type &&
+		got.Class == want.Class &&
+		strings.EqualFold(got.Name.String(), want.Name.String())
+}
+
+// fqdn returns the host as a fully qualified domain name.
+func fqdn(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+
+	return host + "."
+}
@@ -0,0 +1,396 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Options are the configurable options for a Resolver.
+type Options struct {
+	// DefaultTTL is how long addresses are cached when their lookup does
+	// not report a TTL, as is the case for the system resolver.
+	// Default is: 1 minute.
+	DefaultTTL time.Duration
+
+	// MinTTL and MaxTTL bound how long addresses are cached. MinTTL is at
+	// least 10 milliseconds, as entries are refreshed every MinTTL/2, and
+	// MaxTTL at least MinTTL.
+	// Default is: 5 seconds and 1 hour.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+
+	// NegativeTTL is how long hosts which do not exist (NXDOMAIN) are
+	// cached.
+	// Default is: 10 seconds.
+	NegativeTTL time.Duration
+
+	// LookupTimeout is the time limit for a lookup. Lookups are shared by
+	// concurrent callers, so are not bound to any one caller's context.
+	// Default is: 5 seconds.
+	LookupTimeout time.Duration
+
+	// Nameservers, if set, are queried directly, in order, instead of the
+	// system resolver, so that the records' TTLs are honored. Addresses
+	// are "host:port", or IPs for port 53.
+	// Default is: the system resolver.
+	Nameservers []string
+
+	// Upstream, if set, looks up hosts in place of the system resolver or
+	// Nameservers, e.g. to serve fake records in tests.
+	Upstream Upstream
+
+	// Hosts are static addresses of hosts, which are never looked up, like
+	// an /etc/hosts file for the Resolver alone.
+	// Default is: the hosts of the DNSCACHE_HOSTS config variable (see
+	// HostsFromEnv).
+	Hosts map[string][]string
+
+	// FallbackDelay is how long a connection attempt runs before the next
+	// address is also attempted, racing them (RFC 8305). A negative delay
+	// attempts addresses one at a time.
+	// Default is: 250 milliseconds.
+	FallbackDelay time.Duration
+
+	// AttemptTimeout is the time limit for each connection attempt, so that
+	// an unresponsive address does not use up the whole dial's time.
+	// Default is: 5 seconds.
+	AttemptTimeout time.Duration
+
+	// Rotation is how a host's addresses are ordered between dials, to
+	// spread connections across them.
+	// Default is: RotateRoundRobin.
+	Rotation Rotation
+
+	// DemotionPeriod is how long addresses which failed to connect are
+	// attempted after the others.
+	// Default is: 30 seconds.
+	DemotionPeriod time.Duration
+}
+
+// minMinTTL is the lowest MinTTL, bounding how often entries are
+// refreshed.
+const minMinTTL = 10 * time.Millisecond
+
+// withDefaults returns a copy of the options with defaults applied, in
+// place of unset or negative durations, and TTL bounds made consistent.
+func (o Options) withDefaults() Options {
+	if o.DefaultTTL <= 0 {
+		o.DefaultTTL = time.Minute
+	}
+
+	if o.MinTTL <= 0 {
+		o.MinTTL = 5 * time.Second
+	} else if o.MinTTL < minMinTTL {
+		o.MinTTL = minMinTTL
+	}
+
+	if o.MaxTTL <= 0 {
+		o.MaxTTL = time.Hour
+	}
+
+	if o.MaxTTL < o.MinTTL {
+		o.MaxTTL = o.MinTTL
+	}
+
+	if o.NegativeTTL <= 0 {
+		o.NegativeTTL = 10 * time.Second
+	}
+
+	if o.LookupTimeout <= 0 {
+		o.LookupTimeout = 5 * time.Second
+	}
+
+	if o.FallbackDelay == 0 {
+		o.FallbackDelay = 250 * time.Millisecond
+	}
+
+	if o.AttemptTimeout <= 0 {
+		o.AttemptTimeout = 5 * time.Second
+	}
+
+	if o.DemotionPeriod <= 0 {
+		o.DemotionPeriod = 30 * time.Second
+	}
+
+	return o
+}
+
+// Upstream looks up the addresses of hosts for a Resolver.
+type Upstream interface {
+	// LookupHost returns the host's addresses, along with how long they may
+	// be cached, or zero if unknown. Hosts which do not exist should be
+	// reported with a *net.DNSError whose IsNotFound is set, so that they
+	// are cached.
+	LookupHost(ctx context.Context, host string) ([]string, time.Duration, error)
+}
+
+// systemUpstream looks up hosts with the system resolver, which does not
+// report TTLs.
+type systemUpstream struct{}
+
+func (systemUpstream) LookupHost(ctx context.Context, host string) ([]string, time.Duration, error) {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	return addrs, 0, err
+}
+
+// entry is a host's cached addresses, or the error looking it up.
+type entry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+	// used reports whether the entry was used since it was last refreshed;
+	// unused entries are evicted once expired, used ones refreshed
+	used bool
+	// lookup is closed once an in-flight lookup completes, or nil
+	lookup chan struct{}
+	// dials counts the dials of the host, to rotate its addresses
+	dials int
+}
+
+// Resolver is a caching DNS resolver. Cached addresses which are still in
+// use are refreshed in the background before they expire; others are
+// evicted.
+// A Resolver must be stopped with Stop once no longer used.
+type Resolver struct {
+	opts     Options
+	upstream Upstream
+	hosts    map[string][]string
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// demoted holds when addresses which failed to connect did so
+	demoted map[string]time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewResolver returns a new Resolver.
+func NewResolver(opts Options) *Resolver {
+	opts = opts.withDefaults()
+
+	u := opts.Upstream
+	if u == nil && len(opts.Nameservers) > 0 {
+		u = newNameservers(opts.Nameservers)
+	} else if u == nil {
+		u = systemUpstream{}
+	}
+
+	hosts := opts.Hosts
+	if hosts == nil {
+		var err error
+		if hosts, err = HostsFromEnv(); err != nil {
+			log.Warn().Err(err).Msg("Ignoring invalid DNSCACHE_HOSTS")
+		}
+	}
+
+	r := &Resolver{
+		opts:     opts,
+		upstream: u,
+		hosts:    normalizeHosts(hosts),
+		entries:  make(map[string]*entry),
+		demoted:  make(map[string]time.Time),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// Stop stops the Resolver's background refreshes. Lookups still work, but
+// are no longer refreshed ahead of expiry.
+func (r *Resolver) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+}
+
+// LookupHost returns the addresses of the host, from its static hosts or
+// the cache if fresh. If a refresh fails, the stale addresses are
+// returned.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+
+	if addrs, ok := r.hosts[normalizeHost(host)]; ok {
+		observeLookup(host, resultStatic)
+		return append([]string(nil), addrs...), nil
+	}
+
+	r.mu.Lock()
+	e, ok := r.entries[host]
+
+	if !ok {
+		e = &entry{}
+		r.entries[host] = e
+	}
+
+	e.used = true
+
+	if !e.expires.IsZero() && time.Now().Before(e.expires) {
+		addrs, err := e.addrs, e.err
+		r.mu.Unlock()
+
+		if err != nil {
+			observeLookup(host, resultNegativeHit)
+		} else {
+			observeLookup(host, resultHit)
+		}
+
+		return addrs, err
+	}
+
+	// concurrent callers share a single lookup
+	wait := e.lookup
+	if wait == nil {
+		wait = r.startLookup(host, e)
+	}
+	r.mu.Unlock()
+
+	observeLookup(host, resultMiss)
+
+	select {
+	case <-wait:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return e.addrs, e.err
+}
+
+// startLookup starts looking up the host, updating its entry, and returns
+// a channel closed once done. It must be called with r.mu held.
+func (r *Resolver) startLookup(host string, e *entry) chan struct{} {
+	done := make(chan struct{})
+	e.lookup = done
+
+	go func() {
+		defer close(done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.opts.LookupTimeout)
+		defer cancel()
+
+		addrs, ttl, err := r.upstream.LookupHost(ctx, host)
+		now := time.Now()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		e.lookup = nil
+
+		switch {
+		case err == nil:
+			e.addrs, e.err = addrs, nil
+			e.expires = now.Add(r.ttl(ttl))
+
+		case isNotFound(err):
+			e.addrs, e.err = nil, err
+			e.expires = now.Add(r.opts.NegativeTTL)
+
+		case len(e.addrs) > 0:
+			// keep serving the stale addresses, retrying shortly
+			refreshErrors.WithLabelValues(host).Inc()
+			e.expires = now.Add(r.opts.MinTTL)
+
+		default:
+			// transient errors are not cached; the next lookup retries
+			refreshErrors.WithLabelValues(host).Inc()
+			e.err = err
+			e.expires = now
+
+			delete(r.entries, host)
+		}
+	}()
+
+	return done
+}
+
+// ttl returns how long to cache addresses looked up with the given TTL.
+func (r *Resolver) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = r.opts.DefaultTTL
+	}
+
+	if ttl < r.opts.MinTTL {
+		ttl = r.opts.MinTTL
+	}
+
+	if ttl > r.opts.MaxTTL {
+		ttl = r.opts.MaxTTL
+	}
+
+	return ttl
+}
+
+// run refreshes entries in use before they expire, and evicts the others,
+// until the Resolver is stopped.
+func (r *Resolver) run() {
+	defer close(r.done)
+
+	interval := r.opts.MinTTL / 2
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-t.C:
+			r.refresh(now.Add(interval))
+		}
+	}
+}
+
+// refresh refreshes entries in use which expire before the deadline, and
+// evicts expired entries no longer in use, and expired demotions.
+func (r *Resolver) refresh(deadline time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ip, failed := range r.demoted {
+		if time.Since(failed) > r.opts.DemotionPeriod {
+			delete(r.demoted, ip)
+		}
+	}
+
+	for host, e := range r.entries {
+		if e.lookup != nil || e.expires.After(deadline) {
+			continue
+		}
+
+		if !e.used {
+			if time.Now().After(e.expires) {
+				delete(r.entries, host)
+			}
+
+			continue
+		}
+
+		// negative entries are only looked up again on demand
+		if e.err != nil {
+			e.used = false
+			continue
+		}
+
+		e.used = false
+		r.startLookup(host, e)
+	}
+}
+
+// isNotFound reports whether the error is for a host which does not exist.
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
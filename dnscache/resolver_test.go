@@ -0,0 +1,443 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeUpstream answers lookups from a table, counting them.
+type fakeUpstream struct {
+	mu      sync.Mutex
+	hosts   map[string][]string
+	ttl     time.Duration
+	err     error
+	lookups int
+}
+
+func (f *fakeUpstream) LookupHost(ctx context.Context, host string) ([]string, time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lookups++
+
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+
+	addrs, ok := f.hosts[host]
+	if !ok {
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addrs, f.ttl, nil
+}
+
+func (f *fakeUpstream) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.lookups
+}
+
+func newTestResolver(t *testing.T, opts Options, u *fakeUpstream) *Resolver {
+	opts.Upstream = u
+	r := NewResolver(opts)
+	t.Cleanup(r.Stop)
+
+	return r
+}
+
+func TestResolverLookupHost(t *testing.T) {
+	assert := assert.New(t)
+	u := &fakeUpstream{hosts: map[string][]string{"foo.com": {"10.0.0.1"}}}
+	r := newTestResolver(t, Options{}, u)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		addrs, err := r.LookupHost(ctx, "foo.com")
+		assert.Nil(err)
+		assert.Equal([]string{"10.0.0.1"}, addrs)
+	}
+
+	assert.Equal(1, u.count())
+
+	addrs, err := r.LookupHost(ctx, "10.0.0.2")
+	assert.Nil(err)
+	assert.Equal([]string{"10.0.0.2"}, addrs)
+	assert.Equal(1, u.count())
+}
+
+func TestResolverConcurrentLookups(t *testing.T) {
+	u := &fakeUpstream{hosts: map[string][]string{"foo.com": {"10.0.0.1"}}}
+	r := newTestResolver(t, Options{}, u)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			addrs, err := r.LookupHost(context.Background(), "foo.com")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"10.0.0.1"}, addrs)
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1, u.count())
+}
+
+func TestResolverNegativeCache(t *testing.T) {
+	assert := assert.New(t)
+	u := &fakeUpstream{}
+	r := newTestResolver(t, Options{NegativeTTL: 50 * time.Millisecond}, u)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := r.LookupHost(ctx, "foo.com")
+		assert.True(isNotFound(err))
+	}
+
+	assert.Equal(1, u.count())
+
+	time.Sleep(60 * time.Millisecond)
+
+	_, err := r.LookupHost(ctx, "foo.com")
+	assert.True(isNotFound(err))
+	assert.Equal(2, u.count())
+}
+
+func TestResolverErrors(t *testing.T) {
+	assert := assert.New(t)
+	u := &fakeUpstream{err: errors.New("timeout")}
+	r := newTestResolver(t, Options{MinTTL: 10 * time.Millisecond, MaxTTL: 10 * time.Millisecond}, u)
+	ctx := context.Background()
+
+	// lookups are only refreshed on demand
+	r.Stop()
+
+	// transient errors are not cached
+	for i := 1; i <= 2; i++ {
+		_, err := r.LookupHost(ctx, "foo.com")
+		assert.NotNil(err)
+		assert.Equal(i, u.count())
+	}
+
+	u.mu.Lock()
+	u.err = nil
+	u.hosts = map[string][]string{"foo.com": {"10.0.0.1"}}
+	u.mu.Unlock()
+
+	addrs, err := r.LookupHost(ctx, "foo.com")
+	assert.Nil(err)
+	assert.Equal([]string{"10.0.0.1"}, addrs)
+
+	u.mu.Lock()
+	u.err = errors.New("timeout")
+	u.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	// stale addresses are served when a refresh fails
+	addrs, err = r.LookupHost(ctx, "foo.com")
+	assert.Nil(err)
+	assert.Equal([]string{"10.0.0.1"}, addrs)
+}
+
+func TestResolverTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		expected time.Duration
+	}{
+		{"unknown TTL", 0, time.Minute},
+		{"TTL within bounds", 10 * time.Minute, 10 * time.Minute},
+		{"TTL below min", time.Second, 5 * time.Second},
+		{"TTL above max", 24 * time.Hour, time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestResolver(t, Options{}, &fakeUpstream{})
+			assert.Equal(t, test.expected, r.ttl(test.ttl))
+		})
+	}
+}
+
+func TestOptionsWithDefaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		expectedMin time.Duration
+		expectedMax time.Duration
+	}{
+		{"unset TTLs", Options{}, 5 * time.Second, time.Hour},
+		{"negative TTLs", Options{MinTTL: -time.Second, MaxTTL: -time.Second}, 5 * time.Second, time.Hour},
+		{"tiny min TTL", Options{MinTTL: time.Nanosecond}, minMinTTL, time.Hour},
+		{"max TTL below min", Options{MinTTL: time.Minute, MaxTTL: time.Second}, time.Minute, time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			opts := test.opts.withDefaults()
+
+			assert.Equal(test.expectedMin, opts.MinTTL)
+			assert.Equal(test.expectedMax, opts.MaxTTL)
+
+			// the Resolver's refresh loop must start
+			NewResolver(test.opts).Stop()
+		})
+	}
+}
+
+func TestResolverRefresh(t *testing.T) {
+	assert := assert.New(t)
+	u := &fakeUpstream{hosts: map[string][]string{"foo.com": {"10.0.0.1"}, "bar.com": {"10.0.0.2"}}}
+	r := newTestResolver(t, Options{}, u)
+	r.Stop()
+
+	ctx := context.Background()
+	_, _ = r.LookupHost(ctx, "foo.com")
+	_, _ = r.LookupHost(ctx, "bar.com")
+	assert.Equal(2, u.count())
+
+	refresh := func() {
+		r.refresh(time.Now().Add(2 * time.Minute))
+
+		r.mu.Lock()
+		var waits []chan struct{}
+		for _, e := range r.entries {
+			if e.lookup != nil {
+				waits = append(waits, e.lookup)
+			}
+		}
+		r.mu.Unlock()
+
+		for _, wait := range waits {
+			<-wait
+		}
+	}
+
+	// hosts used since their last refresh are refreshed
+	refresh()
+	assert.Equal(4, u.count())
+
+	_, _ = r.LookupHost(ctx, "foo.com")
+	refresh()
+	assert.Equal(5, u.count())
+
+	// once expired, unused hosts are evicted
+	r.mu.Lock()
+	for _, e := range r.entries {
+		e.expires = time.Now().Add(-time.Second)
+	}
+	r.entries["foo.com"].used = true
+	r.mu.Unlock()
+
+	r.refresh(time.Now())
+
+	r.mu.Lock()
+	_, foo := r.entries["foo.com"]
+	_, bar := r.entries["bar.com"]
+	r.mu.Unlock()
+
+	assert.True(foo)
+	assert.False(bar)
+}
+
+func TestResolverAttach(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	_, port, _ := net.SplitHostPort(u.Host)
+
+	r := newTestResolver(t, Options{}, &fakeUpstream{hosts: map[string][]string{"foo.test": {"127.0.0.1"}}})
+
+	tr := &http.Transport{}
+	r.Attach(tr)
+
+	resp, err := (&http.Client{Transport: tr}).Get("http://foo.test:" + port)
+	if assert.Nil(err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal("foo.test:"+port, string(body))
+	}
+
+	_, err = (&http.Client{Transport: tr}).Get("http://bar.test:" + port)
+	assert.True(isNotFound(err))
+}
+
+// serveDNS serves DNS queries over UDP, answering with records from a
+// table, and returns the server's address.
+func serveDNS(t *testing.T, records map[string][]dnsmessage.Resource) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, maxUDPSize)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+
+			q := query.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true},
+				Questions: query.Questions,
+			}
+
+			answers, ok := records[q.Name.String()]
+			if !ok {
+				resp.RCode = dnsmessage.RCodeNameError
+			}
+
+			for _, a := range answers {
+				if a.Header.Type == q.Type || a.Header.Type == dnsmessage.TypeCNAME {
+					resp.Answers = append(resp.Answers, a)
+				}
+			}
+
+			packed, _ := resp.Pack()
+			_, _ = conn.WriteTo(packed, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestNameservers(t *testing.T) {
+	assert := assert.New(t)
+
+	name := dnsmessage.MustNewName("foo.com.")
+	target := dnsmessage.MustNewName("bar.com.")
+
+	addr := serveDNS(t, map[string][]dnsmessage.Resource{
+		"foo.com.": {
+			{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 300},
+				Body:   &dnsmessage.CNAMEResource{CNAME: target},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{Name: target, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 30},
+				Body:   &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{Name: target, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}},
+			},
+		},
+	})
+
+	ns := newNameservers([]string{addr})
+	ctx := context.Background()
+
+	addrs, ttl, err := ns.LookupHost(ctx, "foo.com")
+	assert.Nil(err)
+	assert.Equal([]string{"10.0.0.1", "::1"}, addrs)
+	assert.Equal(30*time.Second, ttl)
+
+	_, _, err = ns.LookupHost(ctx, "missing.com")
+	assert.True(isNotFound(err))
+
+	// unreachable nameservers are skipped
+	ns = newNameservers([]string{"127.0.0.1:1", addr})
+	cctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	addrs, _, err = ns.LookupHost(cctx, "foo.com")
+	assert.Nil(err)
+	assert.Len(addrs, 2)
+}
+
+func TestNameserversSpoofedResponses(t *testing.T) {
+	assert := assert.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, maxUDPSize)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+
+			q := query.Questions[0]
+			answer := func(id uint16, question dnsmessage.Question, ip byte) {
+				resp := dnsmessage.Message{
+					Header:    dnsmessage.Header{ID: id, Response: true},
+					Questions: []dnsmessage.Question{question},
+				}
+
+				if q.Type == dnsmessage.TypeA {
+					resp.Answers = []dnsmessage.Resource{{
+						Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &dnsmessage.AResource{A: [4]byte{10, 0, 0, ip}},
+					}}
+				}
+
+				packed, _ := resp.Pack()
+				_, _ = conn.WriteTo(packed, addr)
+			}
+
+			other := q
+			other.Name = dnsmessage.MustNewName("bar.com.")
+
+			// forged responses, with the wrong ID or question, precede the
+			// genuine one
+			answer(query.ID+1, q, 66)
+			answer(query.ID, other, 66)
+			_, _ = conn.WriteTo([]byte("garbage"), addr)
+			answer(query.ID, q, 1)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	addrs, _, err := newNameservers([]string{conn.LocalAddr().String()}).LookupHost(ctx, "foo.com")
+	assert.Nil(err)
+	assert.Equal([]string{"10.0.0.1"}, addrs)
+}
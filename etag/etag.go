@@ -4,21 +4,155 @@ package etag
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"hash"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
 )
 
-func hash(p []byte) string {
+// Hash is a hash function with which ETags are generated.
+type Hash int
+
+const (
+	// SHA1 hashes with SHA-1, as Generate does.
+	SHA1 Hash = iota
+	// SHA256 hashes with SHA-256.
+	SHA256
+	// FNV hashes with the non-cryptographic, 64-bit FNV-1a.
+	FNV
+	// XXHash hashes with the non-cryptographic, 64-bit xxHash, which is the
+	// fastest for large bodies.
+	XXHash
+)
+
+// new returns a new hash.Hash of the function.
+func (h Hash) new() hash.Hash {
+	switch h {
+	case SHA256:
+		return sha256.New()
+	case FNV:
+		return fnv.New64a()
+	case XXHash:
+		return xxhash.New()
+	default:
+		return sha1.New()
+	}
+}
+
+func sum(p []byte) string {
 	h := sha1.Sum(p)
 	return hex.EncodeToString(h[:])
 }
 
 // Generate an etag for given byte slice. Can be set as weak with second boolean parameter.
 func Generate(p []byte, weak bool) string {
-	tag := fmt.Sprintf("\"%d-%s\"", len(p), hash(p))
+	tag := fmt.Sprintf("\"%d-%s\"", len(p), sum(p))
 	if weak {
 		tag = "W/" + tag
 	}
 
 	return tag
 }
+
+// Options are the configurable options for a Generator.
+type Options struct {
+	// Hash is the hash function of the ETag.
+	// Default is: SHA1.
+	Hash Hash
+
+	// Weak makes the ETag weak.
+	// Default is: false.
+	Weak bool
+}
+
+// Generator is an io.Writer which generates an ETag of the data written to
+// it, hashing it as it is written, so that bodies need not be held in
+// memory:
+//
+//	g := etag.New(etag.Options{Hash: etag.XXHash})
+//	io.Copy(io.MultiWriter(w, g), body)
+//	tag := g.ETag()
+type Generator struct {
+	opts Options
+	h    hash.Hash
+	n    int64
+}
+
+// New returns a new Generator.
+func New(opts Options) *Generator {
+	return &Generator{
+		opts: opts,
+		h:    opts.Hash.new(),
+	}
+}
+
+// Write adds p to the data the ETag is generated for. It never returns an
+// error.
+func (g *Generator) Write(p []byte) (int, error) {
+	g.n += int64(len(p))
+	return g.h.Write(p)
+}
+
+// ETag returns the ETag of the data written so far, in the same format as
+// Generate.
+func (g *Generator) ETag() string {
+	tag := "\"" + strconv.FormatInt(g.n, 10) + "-" + hex.EncodeToString(g.h.Sum(nil)) + "\""
+	if g.opts.Weak {
+		tag = Weak(tag)
+	}
+
+	return tag
+}
+
+// Reset discards the data written so far.
+func (g *Generator) Reset() {
+	g.h.Reset()
+	g.n = 0
+}
+
+// FromVersion returns a strong ETag derived from the parts identifying a
+// version of a resource, e.g. a document's ID and revision number or
+// modification time, so that no body need be hashed:
+//
+//	w.Header().Set("ETag", etag.FromVersion(doc.ID, doc.Revision))
+//
+// Responses whose bodies vary for a version, e.g. by content negotiation,
+// should use a weak ETag instead (see Weak), or add the variant's parts.
+func FromVersion(parts ...interface{}) string {
+	var (
+		h      = fnv.New64a()
+		length [binary.MaxVarintLen64]byte
+	)
+
+	for _, part := range parts {
+		if t, ok := part.(time.Time); ok {
+			// formatted without the location and monotonic clock reading,
+			// which do not change the time
+			part = t.UTC().Format(time.RFC3339Nano)
+		}
+
+		// parts are prefixed with their length, so that no two lists of
+		// parts hash the same input
+		s := fmt.Sprint(part)
+		h.Write(length[:binary.PutUvarint(length[:], uint64(len(s)))])
+		h.Write([]byte(s))
+	}
+
+	return "\"v-" + hex.EncodeToString(h.Sum(nil)) + "\""
+}
+
+// Weak returns the weak form of the ETag.
+func Weak(tag string) string {
+	if tag == "" || strings.HasPrefix(tag, "W/") {
+		return tag
+	}
+
+	return "W/" + tag
+}
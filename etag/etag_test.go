@@ -1,7 +1,10 @@
 package etag_test
 
 import (
+	"bytes"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/nickhstr/goweb/etag"
 	"github.com/stretchr/testify/assert"
@@ -73,3 +76,82 @@ func BenchmarkGenerate(b *testing.B) {
 
 	benchedTag = hash
 }
+
+func TestGenerator(t *testing.T) {
+	data := []byte("some text, written in chunks")
+
+	for _, h := range []etag.Hash{etag.SHA1, etag.SHA256, etag.FNV, etag.XXHash} {
+		t.Run(fmt.Sprintf("hash %d", h), func(t *testing.T) {
+			assert := assert.New(t)
+
+			whole := etag.New(etag.Options{Hash: h})
+			whole.Write(data)
+
+			chunked := etag.New(etag.Options{Hash: h})
+			for i := 0; i < len(data); i += 5 {
+				end := i + 5
+				if end > len(data) {
+					end = len(data)
+				}
+
+				chunked.Write(data[i:end])
+			}
+
+			assert.Equal(whole.ETag(), chunked.ETag())
+			assert.Regexp(`^"28-[0-9a-f]+"$`, whole.ETag())
+
+			chunked.Reset()
+			chunked.Write([]byte("different text"))
+			assert.NotEqual(whole.ETag(), chunked.ETag())
+
+			weak := etag.New(etag.Options{Hash: h, Weak: true})
+			weak.Write(data)
+			assert.Equal("W/"+whole.ETag(), weak.ETag())
+		})
+	}
+
+	t.Run("SHA1 should match Generate", func(t *testing.T) {
+		g := etag.New(etag.Options{})
+		g.Write(data)
+
+		assert.Equal(t, etag.Generate(data, false), g.ETag())
+	})
+}
+
+func TestFromVersion(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+
+	assert.Equal(etag.FromVersion("foo", 1), etag.FromVersion("foo", 1))
+	assert.NotEqual(etag.FromVersion("foo", 1), etag.FromVersion("foo", 2))
+	assert.NotEqual(etag.FromVersion("ab", "c"), etag.FromVersion("a", "bc"))
+	assert.NotEqual(etag.FromVersion("a\x00b"), etag.FromVersion("a", "b"))
+	assert.NotEqual(etag.FromVersion(""), etag.FromVersion())
+	assert.Equal(etag.FromVersion("foo", now), etag.FromVersion("foo", now.Round(0).In(time.FixedZone("X", 3600))))
+	assert.Regexp(`^"v-[0-9a-f]{16}"$`, etag.FromVersion("foo", 1))
+}
+
+func TestWeak(t *testing.T) {
+	assert.Equal(t, `W/"foo"`, etag.Weak(`"foo"`))
+	assert.Equal(t, `W/"foo"`, etag.Weak(`W/"foo"`))
+	assert.Equal(t, "", etag.Weak(""))
+}
+
+func BenchmarkGenerator(b *testing.B) {
+	content := bytes.Repeat([]byte("Just testing some content here, don't mind me.\n"), 1000)
+
+	for _, h := range []etag.Hash{etag.SHA1, etag.SHA256, etag.FNV, etag.XXHash} {
+		b.Run(fmt.Sprintf("hash %d", h), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(content)))
+
+			g := etag.New(etag.Options{Hash: h})
+
+			for n := 0; n < b.N; n++ {
+				g.Reset()
+				g.Write(content)
+				benchedTag = g.ETag()
+			}
+		})
+	}
+}
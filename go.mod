@@ -3,31 +3,34 @@ module github.com/nickhstr/goweb
 go 1.15
 
 require (
+	github.com/andybalholm/brotli v1.0.0
 	github.com/bmatcuk/doublestar v1.3.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.1
 	github.com/cortesi/modd v0.0.0-20200427000656-b4c550997d80
 	github.com/cortesi/moddwatch v0.0.0-20200427000745-d26468c93cf0 // indirect
 	github.com/dghubble/sling v1.3.0
 	github.com/go-chi/chi v4.1.2+incompatible
 	github.com/go-redis/redis/v7 v7.4.0
 	github.com/golangci/golangci-lint v1.27.0
-	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.4
+	github.com/klauspost/compress v1.9.5
 	github.com/mattn/go-colorable v0.1.7 // indirect
 	github.com/newrelic/go-agent/v3 v3.7.0
-	github.com/newrelic/go-agent/v3/integrations/nrgorilla v1.1.0
 	github.com/newrelic/go-agent/v3/integrations/nrmongo v1.0.0
 	github.com/newrelic/go-agent/v3/integrations/nrredis-v7 v1.0.0
 	github.com/prometheus/client_golang v1.7.1
 	github.com/psampaz/go-mod-outdated v0.6.0
 	github.com/rs/cors v1.7.0
-	github.com/rs/dnscache v0.0.0-20190621150935-06bb5526f76b
 	github.com/rs/zerolog v1.19.0
 	github.com/spf13/viper v1.7.1
-	github.com/stretchr/testify v1.6.1
+	github.com/stretchr/testify v1.7.0
 	github.com/unrolled/secure v1.0.8
 	go.mongodb.org/mongo-driver v1.3.4
-	golang.org/x/net v0.0.0-20200625001655-4c5254603344 // indirect
-	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+	golang.org/x/net v0.0.0-20200625001655-4c5254603344
 	gopkg.in/h2non/gock.v1 v1.0.15
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
 )
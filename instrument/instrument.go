@@ -0,0 +1,149 @@
+// Package instrument provides a vendor-neutral instrumentation API.
+// Transactions, segments, error noticing and custom attributes are recorded
+// through an Instrumenter, which is a no-op until an implementation (such as
+// the one in the newrelic or tracing packages) is installed with Set.
+package instrument
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Instrumenter starts transactions for incoming requests.
+type Instrumenter interface {
+	// StartTransaction starts a named transaction for the request.
+	// The returned ResponseWriter and Request must be used in place of
+	// the originals, so that the response is recorded and the transaction
+	// is available to downstream handlers.
+	StartTransaction(name string, w http.ResponseWriter, r *http.Request) (Transaction, http.ResponseWriter, *http.Request)
+}
+
+// Transaction is a single unit of instrumented work, such as an HTTP
+// request.
+type Transaction interface {
+	// AddAttribute adds a custom attribute to the transaction.
+	AddAttribute(key string, value interface{})
+	// End finishes the transaction.
+	End()
+	// NoticeError records an error on the transaction.
+	NoticeError(err error)
+	// SetName renames the transaction.
+	SetName(name string)
+	// StartSegment starts a named segment of work within the transaction.
+	StartSegment(name string) Segment
+}
+
+// Segment is a timed portion of a transaction.
+type Segment interface {
+	// End finishes the segment.
+	End()
+}
+
+var (
+	mu      = &sync.RWMutex{}
+	current = Instrumenter(Noop{})
+)
+
+// Set installs the Instrumenter used by this package's middleware and
+// handlers. Passing nil restores the no-op default.
+func Set(i Instrumenter) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if i == nil {
+		i = Noop{}
+	}
+
+	current = i
+}
+
+// Get returns the installed Instrumenter.
+func Get() Instrumenter {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return current
+}
+
+// txnContextKey is the context key under which a request's Transaction is
+// stored.
+type txnContextKey struct{}
+
+var txnKey = txnContextKey{}
+
+// NewContext returns a copy of parent which carries the Transaction.
+func NewContext(parent context.Context, txn Transaction) context.Context {
+	return context.WithValue(parent, txnKey, txn)
+}
+
+// FromContext returns the Transaction stored in ctx, or a no-op
+// Transaction if there is none.
+func FromContext(ctx context.Context) Transaction {
+	if txn, ok := ctx.Value(txnKey).(Transaction); ok {
+		return txn
+	}
+
+	return noopTransaction{}
+}
+
+// StartSegment starts a segment on the context's Transaction.
+func StartSegment(ctx context.Context, name string) Segment {
+	return FromContext(ctx).StartSegment(name)
+}
+
+// NoticeError records an error on the context's Transaction.
+func NoticeError(ctx context.Context, err error) {
+	FromContext(ctx).NoticeError(err)
+}
+
+// AddAttribute adds a custom attribute to the context's Transaction.
+func AddAttribute(ctx context.Context, key string, value interface{}) {
+	FromContext(ctx).AddAttribute(key, value)
+}
+
+// Handler wraps an http.Handler with a transaction of the given name.
+// The installed Instrumenter is looked up per request, so Handler may be
+// used before an implementation is installed.
+func Handler(name string, h http.Handler) http.Handler {
+	return Middleware(func(*http.Request) string { return name })(h)
+}
+
+// Middleware starts a transaction for each request, named by the given
+// function.
+func Middleware(name func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			txn, w, r := Get().StartTransaction(name(r), w, r)
+			defer txn.End()
+
+			r = r.WithContext(NewContext(r.Context(), txn))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Noop is an Instrumenter which records nothing.
+type Noop struct{}
+
+// StartTransaction returns a no-op Transaction, and the unmodified
+// ResponseWriter and Request.
+func (Noop) StartTransaction(name string, w http.ResponseWriter, r *http.Request) (Transaction, http.ResponseWriter, *http.Request) {
+	return noopTransaction{}, w, r
+}
+
+type noopTransaction struct{}
+
+func (noopTransaction) AddAttribute(string, interface{}) {}
+func (noopTransaction) End()                             {}
+func (noopTransaction) NoticeError(error)                {}
+func (noopTransaction) SetName(string)                   {}
+func (noopTransaction) StartSegment(string) Segment      { return noopSegment{} }
+
+type noopSegment struct{}
+
+func (noopSegment) End() {}
+
+// sanity check for satisfaction of Instrumenter interface
+var _ Instrumenter = Noop{}
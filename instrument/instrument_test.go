@@ -0,0 +1,97 @@
+package instrument_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nickhstr/goweb/instrument"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTransaction struct {
+	name       string
+	attributes map[string]interface{}
+	errs       []error
+	segments   []string
+	ended      bool
+}
+
+func (f *fakeTransaction) AddAttribute(key string, value interface{}) { f.attributes[key] = value }
+func (f *fakeTransaction) End()                                       { f.ended = true }
+func (f *fakeTransaction) NoticeError(err error)                      { f.errs = append(f.errs, err) }
+func (f *fakeTransaction) SetName(name string)                        { f.name = name }
+func (f *fakeTransaction) StartSegment(name string) instrument.Segment {
+	f.segments = append(f.segments, name)
+	return fakeSegment{}
+}
+
+type fakeSegment struct{}
+
+func (fakeSegment) End() {}
+
+type fakeInstrumenter struct {
+	txns []*fakeTransaction
+}
+
+func (f *fakeInstrumenter) StartTransaction(
+	name string,
+	w http.ResponseWriter,
+	r *http.Request,
+) (instrument.Transaction, http.ResponseWriter, *http.Request) {
+	txn := &fakeTransaction{name: name, attributes: map[string]interface{}{}}
+	f.txns = append(f.txns, txn)
+
+	return txn, w, r
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+	fake := &fakeInstrumenter{}
+
+	instrument.Set(fake)
+	defer instrument.Set(nil)
+
+	testErr := errors.New("oops")
+	h := instrument.Handler("test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		instrument.AddAttribute(ctx, "key", "value")
+		instrument.NoticeError(ctx, testErr)
+		instrument.StartSegment(ctx, "work").End()
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !assert.Len(fake.txns, 1) {
+		return
+	}
+
+	txn := fake.txns[0]
+	assert.Equal("test", txn.name)
+	assert.Equal("value", txn.attributes["key"])
+	assert.Equal([]error{testErr}, txn.errs)
+	assert.Equal([]string{"work"}, txn.segments)
+	assert.True(txn.ended)
+}
+
+func TestNoop(t *testing.T) {
+	assert := assert.New(t)
+
+	// a context without a transaction should be safe to use
+	assert.NotPanics(func() {
+		ctx := context.Background()
+		instrument.AddAttribute(ctx, "key", "value")
+		instrument.NoticeError(ctx, errors.New("oops"))
+		instrument.StartSegment(ctx, "work").End()
+	})
+
+	respRec := httptest.NewRecorder()
+	h := instrument.Handler("test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	h.ServeHTTP(respRec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(http.StatusTeapot, respRec.Code)
+}
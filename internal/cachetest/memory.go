@@ -0,0 +1,105 @@
+// Package cachetest provides an in-memory cache.Cacher for tests.
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Memory for keys it does not hold.
+var ErrNotFound = errors.New("cachetest: key not found")
+
+// Memory is an in-memory cache.Cacher. Expired values are removed as they
+// are read.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemory returns a new, empty Memory.
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]memoryEntry)}
+}
+
+func (m *Memory) Del(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if ok && e.expired(time.Now()) {
+		delete(m.entries, key)
+		ok = false
+	}
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), e.data...), nil
+}
+
+// Set stores a value, which must be a []byte or a string. A zero
+// expiration stores the value until it is deleted, as with Redis.
+func (m *Memory) Set(ctx context.Context, key string, v interface{}, expiration time.Duration) error {
+	var data []byte
+
+	switch v := v.(type) {
+	case []byte:
+		data = append([]byte(nil), v...)
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cachetest: unsupported value type %T", v)
+	}
+
+	e := memoryEntry{data: data}
+	if expiration > 0 {
+		e.expires = time.Now().Add(expiration)
+	}
+
+	m.mu.Lock()
+	m.entries[key] = e
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Len returns the number of values held, which have not expired.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+
+	for _, e := range m.entries {
+		if !e.expired(now) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
@@ -0,0 +1,45 @@
+package cachetest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nickhstr/goweb/internal/cachetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	m := cachetest.NewMemory()
+
+	assert.Nil(m.Set(ctx, "bytes", []byte("foo"), 0))
+	assert.Nil(m.Set(ctx, "string", "bar", time.Minute))
+	assert.Nil(m.Set(ctx, "expired", "baz", time.Nanosecond))
+	assert.NotNil(m.Set(ctx, "int", 1, 0))
+
+	time.Sleep(time.Millisecond)
+
+	data, err := m.Get(ctx, "bytes")
+	assert.Nil(err)
+	assert.Equal("foo", string(data))
+
+	data, err = m.Get(ctx, "string")
+	assert.Nil(err)
+	assert.Equal("bar", string(data))
+
+	// values read are copies
+	data[0] = 'c'
+	data, _ = m.Get(ctx, "string")
+	assert.Equal("bar", string(data))
+
+	_, err = m.Get(ctx, "expired")
+	assert.Equal(cachetest.ErrNotFound, err)
+	assert.Equal(2, m.Len())
+
+	assert.Nil(m.Del(ctx, "bytes", "missing"))
+	_, err = m.Get(ctx, "bytes")
+	assert.Equal(cachetest.ErrNotFound, err)
+	assert.Equal(1, m.Len())
+}
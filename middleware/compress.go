@@ -0,0 +1,423 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/nickhstr/goweb/etag"
+)
+
+// Content codings supported by the Compress middleware.
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+	EncodingZstd   = "zstd"
+)
+
+// CompressOptions are the configurable options for the Compress middleware.
+type CompressOptions struct {
+	// Encodings are the content codings responses may be compressed with,
+	// in order of preference, used when a client accepts several equally.
+	// Default is: br, zstd, gzip.
+	Encodings []string
+
+	// MinSize is the size of the smallest response body compressed.
+	// Smaller bodies are sent as they are, as compressing them saves
+	// little, if anything.
+	// Default is: 1KB.
+	MinSize int
+
+	// ContentTypes are the media types of responses compressed. A "*"
+	// matches any part of a type, e.g. "text/*" or "application/*+json".
+	// Responses without a Content-Type header have theirs detected.
+	// Defaults are: text/*, application/json, application/*+json,
+	// application/javascript, application/xml, application/*+xml,
+	// application/wasm, image/svg+xml.
+	ContentTypes []string
+}
+
+// withDefaults returns a copy of the options with defaults applied.
+func (o CompressOptions) withDefaults() CompressOptions {
+	if len(o.Encodings) == 0 {
+		o.Encodings = []string{EncodingBrotli, EncodingZstd, EncodingGzip}
+	}
+
+	if o.MinSize == 0 {
+		o.MinSize = 1 << 10
+	}
+
+	if len(o.ContentTypes) == 0 {
+		o.ContentTypes = []string{
+			"text/*",
+			"application/json",
+			"application/*+json",
+			"application/javascript",
+			"application/xml",
+			"application/*+xml",
+			"application/wasm",
+			"image/svg+xml",
+		}
+	}
+
+	return o
+}
+
+// Compress middleware compresses response bodies with the content coding
+// the request's Accept-Encoding header prefers, of those supported, and
+// adds Accept-Encoding to the Vary header.
+// Only bodies of at least the minimum size and of the allowed content
+// types are compressed, and never partial (206) responses, nor responses
+// which already have a Content-Encoding.
+// ETags of compressed responses are made weak, as their bodies are no
+// longer byte for byte identical to the handler's; Compress should be
+// placed before the Etag middleware, so that ETags are computed over the
+// uncompressed body, and shared by all content codings.
+func Compress(opts CompressOptions) Middleware {
+	opts = opts.withDefaults()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &compressWriter{
+				ResponseWriter: w,
+				opts:           opts,
+				encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Encodings),
+			}
+
+			// the response of a handler which panics is left to Recover,
+			// rather than sent with the body written before the panic
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// encoder is a pooled compressor of a content coding.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingBrotli: {
+		New: func() interface{} {
+			// level 4 compresses better than gzip, at similar speed, which
+			// suits responses compressed as they are served
+			return brotli.NewWriterLevel(nil, 4)
+		},
+	},
+	EncodingGzip: {
+		New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+			return w
+		},
+	},
+	EncodingZstd: {
+		New: func() interface{} {
+			// one goroutine per encoder, as each compresses a single response
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			return w
+		},
+	},
+}
+
+// negotiateEncoding returns the supported content coding the Accept-Encoding
+// header gives the highest quality value, preferring those listed first in
+// supported, or an empty string if the response should not be compressed.
+func negotiateEncoding(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+
+	for _, part := range strings.Split(header, ",") {
+		coding, q := parseCoding(part)
+		if coding != "" {
+			qualities[coding] = q
+		}
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+
+	for _, coding := range supported {
+		if _, ok := encoderPools[coding]; !ok {
+			continue
+		}
+
+		q, ok := qualities[coding]
+		if !ok {
+			q = qualities["*"]
+		}
+
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	return best
+}
+
+// parseCoding parses an element of the Accept-Encoding header, e.g.
+// "gzip;q=0.8", returning its lower case content coding and quality value,
+// which is 1 when absent, and 0 when invalid.
+func parseCoding(s string) (string, float64) {
+	params := strings.Split(s, ";")
+	coding := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+
+	for _, param := range params[1:] {
+		param = strings.TrimSpace(param)
+		if len(param) < 2 || param[0] != 'q' && param[0] != 'Q' || param[1] != '=' {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(param[2:], 64)
+		if err != nil || v < 0 || v > 1 {
+			v = 0
+		}
+
+		q = v
+	}
+
+	return coding, q
+}
+
+// matchesContentType reports whether the media type matches any of the
+// patterns.
+func matchesContentType(mediaType string, patterns []string) bool {
+	for _, pattern := range patterns {
+		star := strings.IndexByte(pattern, '*')
+		if star < 0 {
+			if mediaType == pattern {
+				return true
+			}
+
+			continue
+		}
+
+		prefix, suffix := pattern[:star], pattern[star+1:]
+		if len(mediaType) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(mediaType, prefix) &&
+			strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compressWriter buffers the start of a response, until it is known whether
+// to compress it, then compresses it or passes it through.
+type compressWriter struct {
+	http.ResponseWriter
+	opts     CompressOptions
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		if len(cw.buf)+len(p) < cw.opts.MinSize {
+			cw.buf = append(cw.buf, p...)
+			return len(p), nil
+		}
+
+		if err := cw.decide(true, p); err != nil {
+			return 0, err
+		}
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been written, compressed if the response is
+// eligible, regardless of its size, as the handler streams it.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+
+		if err := cw.decide(true, nil); err != nil {
+			return
+		}
+	}
+
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return
+		}
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, e.g. for WebSockets,
+// whose data is never compressed.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: ResponseWriter does not implement http.Hijacker")
+	}
+
+	cw.decided = true
+
+	return hj.Hijack()
+}
+
+// decide writes the header, with or without compression, and the buffered
+// body. Responses are compressed only if large enough, which the caller
+// reports, and eligible. next is the body written next, used to detect the
+// content type when the buffer is empty.
+func (cw *compressWriter) decide(largeEnough bool, next []byte) error {
+	cw.decided = true
+	h := cw.Header()
+
+	addVary(h, "Accept-Encoding")
+
+	compress := largeEnough && cw.compressible(next)
+
+	// the body of a 304 (Not Modified) response is unknown, so its ETag is
+	// weakened whenever the full response may have been compressed
+	if compress || cw.status == http.StatusNotModified && cw.encoding != "" {
+		if tag := h.Get("ETag"); tag != "" {
+			h.Set("ETag", etag.Weak(tag))
+		}
+	}
+
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+
+	cw.buf = nil
+
+	return err
+}
+
+// compressible reports whether the response should be compressed, setting
+// its Content-Type header if it has none, as net/http would.
+func (cw *compressWriter) compressible(next []byte) bool {
+	h := cw.Header()
+
+	if cw.encoding == "" ||
+		cw.status < http.StatusOK ||
+		cw.status == http.StatusNoContent ||
+		cw.status == http.StatusPartialContent ||
+		cw.status == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		sniff := cw.buf
+		if len(sniff) == 0 {
+			sniff = next
+		}
+
+		if len(sniff) == 0 {
+			return false
+		}
+
+		ct = http.DetectContentType(sniff)
+		h.Set("Content-Type", ct)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+
+	return matchesContentType(mediaType, cw.opts.ContentTypes)
+}
+
+// close finishes the response once the handler returns, writing the
+// uncompressed body of responses too small to compress.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+
+		if err := cw.decide(false, nil); err != nil {
+			return
+		}
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		cw.enc.Reset(nil)
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// addVary adds the header name to the Vary header, unless already listed.
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", name)
+}
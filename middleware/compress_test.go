@@ -0,0 +1,283 @@
+package middleware_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/nickhstr/goweb/etag"
+	"github.com/nickhstr/goweb/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("compress me, please. ", 100)
+	small := "too small"
+
+	textHandler := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Length", "1234")
+			w.Write([]byte(body))
+		})
+	}
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		handler          http.Handler
+		expectedEncoding string
+		expectedBody     string
+	}{
+		{
+			"should not compress without Accept-Encoding",
+			"",
+			textHandler(large),
+			"",
+			large,
+		},
+		{
+			"should prefer brotli when all are accepted",
+			"gzip, deflate, br, zstd",
+			textHandler(large),
+			"br",
+			large,
+		},
+		{
+			"should compress with gzip",
+			"gzip",
+			textHandler(large),
+			"gzip",
+			large,
+		},
+		{
+			"should compress with zstd",
+			"zstd",
+			textHandler(large),
+			"zstd",
+			large,
+		},
+		{
+			"should choose the highest quality value",
+			"br;q=0.5, gzip;q=0.9, zstd;q=0.1",
+			textHandler(large),
+			"gzip",
+			large,
+		},
+		{
+			"should not use refused codings",
+			"*, br;q=0, zstd;q=0",
+			textHandler(large),
+			"gzip",
+			large,
+		},
+		{
+			"should not compress when only unsupported codings are accepted",
+			"deflate, compress",
+			textHandler(large),
+			"",
+			large,
+		},
+		{
+			"should not compress small bodies",
+			"gzip",
+			textHandler(small),
+			"",
+			small,
+		},
+		{
+			"should compress bodies written in parts",
+			"gzip",
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				for i := 0; i < 100; i++ {
+					w.Write([]byte(`{"compress":"me"}`))
+				}
+			}),
+			"gzip",
+			strings.Repeat(`{"compress":"me"}`, 100),
+		},
+		{
+			"should not compress disallowed content types",
+			"gzip",
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte(large))
+			}),
+			"",
+			large,
+		},
+		{
+			"should detect missing content types",
+			"gzip",
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(large))
+			}),
+			"gzip",
+			large,
+		},
+		{
+			"should not compress encoded responses",
+			"gzip",
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", "identity")
+				w.Write([]byte(large))
+			}),
+			"identity",
+			large,
+		},
+		{
+			"should not compress partial responses",
+			"gzip",
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(large))
+			}),
+			"",
+			large,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+
+			w := httptest.NewRecorder()
+			middleware.Compress(middleware.CompressOptions{})(test.handler).ServeHTTP(w, r)
+
+			res := w.Result()
+			assert.Equal(test.expectedEncoding, res.Header.Get("Content-Encoding"))
+			assert.Equal("Accept-Encoding", res.Header.Get("Vary"))
+
+			if test.expectedEncoding != "" && test.expectedEncoding != "identity" {
+				assert.Empty(res.Header.Get("Content-Length"))
+			}
+
+			assert.Equal(test.expectedBody, decompress(t, test.expectedEncoding, w.Body))
+		})
+	}
+}
+
+func TestCompressEtag(t *testing.T) {
+	assert := assert.New(t)
+	body := strings.Repeat("tag me, then compress me. ", 100)
+	tag := etag.Generate([]byte(body), false)
+
+	h := middleware.Compose(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(body))
+		}),
+		middleware.Compress(middleware.CompressOptions{}),
+		middleware.EtagWithOptions(middleware.EtagOptions{}),
+	)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(etag.Weak(tag), w.Header().Get("ETag"))
+	assert.Equal(body, decompress(t, "gzip", w.Body))
+
+	// the weakened tag revalidates
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(http.StatusNotModified, w.Code)
+	assert.Empty(w.Header().Get("Content-Encoding"))
+	assert.Equal(etag.Weak(tag), w.Header().Get("ETag"))
+	assert.Equal("Accept-Encoding", w.Header().Get("Vary"))
+	assert.Empty(w.Body.String())
+}
+
+func TestCompressFlush(t *testing.T) {
+	assert := assert.New(t)
+
+	h := middleware.Compress(middleware.CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("data: second\n\n"))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.True(w.Flushed)
+	assert.Equal("gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal("data: first\n\ndata: second\n\n", decompress(t, "gzip", w.Body))
+}
+
+func TestCompressPanic(t *testing.T) {
+	assert := assert.New(t)
+
+	h := middleware.Recover(middleware.Compress(middleware.CompressOptions{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("partial"))
+			panic("ruh roh")
+		}),
+	))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.NotContains(w.Body.String(), "partial")
+}
+
+func decompress(t *testing.T, encoding string, body io.Reader) string {
+	var (
+		r   io.Reader
+		err error
+	)
+
+	switch encoding {
+	case "br":
+		r = brotli.NewReader(body)
+	case "gzip":
+		r, err = gzip.NewReader(body)
+	case "zstd":
+		var d *zstd.Decoder
+		d, err = zstd.NewReader(body)
+
+		if err == nil {
+			defer d.Close()
+		}
+
+		r = d
+	default:
+		r = body
+	}
+
+	require.NoError(t, err)
+
+	p, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(p)
+}
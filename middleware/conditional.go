@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// precondition is the result of evaluating a request's preconditions.
+type precondition int
+
+const (
+	// preconditionNone means the request should be served as usual.
+	preconditionNone precondition = iota
+	// preconditionNotModified means a 304 (Not Modified) response should
+	// be sent.
+	preconditionNotModified
+	// preconditionFailed means a 412 (Precondition Failed) response should
+	// be sent.
+	preconditionFailed
+)
+
+// SetLastModified sets the Last-Modified header, which EtagWithOptions
+// and CheckPreconditions evaluate If-Modified-Since and
+// If-Unmodified-Since headers against.
+func SetLastModified(w http.ResponseWriter, t time.Time) {
+	if !t.IsZero() {
+		w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// CheckPreconditions evaluates the request's conditional headers (RFC 7232)
+// against the current ETag and modification time of the requested
+// resource, which should be empty and zero if it does not exist.
+// If the request should not be served, a 304 (Not Modified) or 412
+// (Precondition Failed) response is written, and true returned.
+// Handlers of unsafe methods, e.g. PUT, should call it before making any
+// changes, so that an If-Match header prevents lost updates.
+func CheckPreconditions(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	exists := etag != "" || !lastModified.IsZero()
+
+	switch evaluatePreconditions(r, etag, lastModified, exists) {
+	case preconditionNotModified:
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+
+		SetLastModified(w, lastModified)
+		writeNotModified(w)
+
+		return true
+
+	case preconditionFailed:
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return true
+	}
+
+	return false
+}
+
+// evaluatePreconditions evaluates the request's conditional headers in the
+// order of RFC 7232, section 6.
+func evaluatePreconditions(r *http.Request, etag string, lastModified time.Time, exists bool) precondition {
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !matchesETag(im, etag, exists, false) {
+			return preconditionFailed
+		}
+	} else if ius, ok := parseHTTPTime(r.Header.Get("If-Unmodified-Since")); ok && !lastModified.IsZero() {
+		if lastModified.Truncate(time.Second).After(ius) {
+			return preconditionFailed
+		}
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !matchesETag(inm, etag, exists, true) {
+			return preconditionNone
+		}
+
+		if safe {
+			return preconditionNotModified
+		}
+
+		return preconditionFailed
+	}
+
+	if ims, ok := parseHTTPTime(r.Header.Get("If-Modified-Since")); ok && safe && !lastModified.IsZero() {
+		if !lastModified.Truncate(time.Second).After(ims) {
+			return preconditionNotModified
+		}
+	}
+
+	return preconditionNone
+}
+
+// parseHTTPTime parses an HTTP date, reporting false for empty or invalid
+// dates, which are ignored.
+func parseHTTPTime(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	t, err := http.ParseTime(s)
+
+	return t, err == nil
+}
+
+// matchesETag reports whether the header's list of entity tags, or "*",
+// matches the ETag, using weak or strong comparison.
+func matchesETag(header, etag string, exists, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return exists
+	}
+
+	if etag == "" {
+		return false
+	}
+
+	for header != "" {
+		var candidate string
+
+		candidate, header = scanETag(header)
+		if candidate == "" {
+			return false
+		}
+
+		if weak && weakMatch(candidate, etag) || !weak && strongMatch(candidate, etag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanETag returns the first entity tag of a comma separated list, and the
+// rest of the list, or an empty tag if the list is malformed.
+func scanETag(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t,")
+
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+
+	if len(s[start:]) < 2 || s[start] != '"' {
+		return "", ""
+	}
+
+	end := strings.IndexByte(s[start+1:], '"')
+	if end < 0 {
+		return "", ""
+	}
+
+	end += start + 2
+
+	return s[:end], strings.TrimLeft(s[end:], " \t,")
+}
+
+// strongMatch reports whether both tags are strong and identical.
+func strongMatch(a, b string) bool {
+	return a == b && a != "" && !strings.HasPrefix(a, "W/")
+}
+
+// weakMatch reports whether the tags are identical, ignoring weakness.
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// writeNotModified writes a 304 (Not Modified) response, without the
+// headers describing a body.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+
+	w.WriteHeader(http.StatusNotModified)
+}
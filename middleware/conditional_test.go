@@ -0,0 +1,251 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nickhstr/goweb/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	var (
+		modified = time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+		before   = modified.Add(-time.Hour).Format(http.TimeFormat)
+		after    = modified.Add(time.Hour).Format(http.TimeFormat)
+		at       = modified.Format(http.TimeFormat)
+	)
+
+	tests := []struct {
+		name           string
+		method         string
+		header         http.Header
+		etag           string
+		lastModified   time.Time
+		expectedStatus int
+	}{
+		{"no conditions", http.MethodGet, http.Header{}, `"a"`, modified, 0},
+		{
+			"If-None-Match matches",
+			http.MethodGet,
+			http.Header{"If-None-Match": {`"a"`}},
+			`"a"`,
+			modified,
+			http.StatusNotModified,
+		},
+		{
+			"If-None-Match matches a list, weakly",
+			http.MethodGet,
+			http.Header{"If-None-Match": {`"x", W/"a,b" ,"y"`}},
+			`"a,b"`,
+			modified,
+			http.StatusNotModified,
+		},
+		{
+			"If-None-Match does not match",
+			http.MethodGet,
+			http.Header{"If-None-Match": {`"b", "c"`}},
+			`"a"`,
+			modified,
+			0,
+		},
+		{
+			"If-None-Match matches any",
+			http.MethodGet,
+			http.Header{"If-None-Match": {"*"}},
+			`"a"`,
+			time.Time{},
+			http.StatusNotModified,
+		},
+		{
+			"If-None-Match any, for a new resource",
+			http.MethodPut,
+			http.Header{"If-None-Match": {"*"}},
+			"",
+			time.Time{},
+			0,
+		},
+		{
+			"If-None-Match any, for an existing resource",
+			http.MethodPut,
+			http.Header{"If-None-Match": {"*"}},
+			`"a"`,
+			time.Time{},
+			http.StatusPreconditionFailed,
+		},
+		{
+			"If-Match matches",
+			http.MethodPut,
+			http.Header{"If-Match": {`"b", "a"`}},
+			`"a"`,
+			modified,
+			0,
+		},
+		{
+			"If-Match does not match",
+			http.MethodPut,
+			http.Header{"If-Match": {`"b"`}},
+			`"a"`,
+			modified,
+			http.StatusPreconditionFailed,
+		},
+		{
+			"If-Match compares strongly",
+			http.MethodPut,
+			http.Header{"If-Match": {`W/"a"`}},
+			`W/"a"`,
+			modified,
+			http.StatusPreconditionFailed,
+		},
+		{
+			"If-Match any, for a missing resource",
+			http.MethodDelete,
+			http.Header{"If-Match": {"*"}},
+			"",
+			time.Time{},
+			http.StatusPreconditionFailed,
+		},
+		{
+			"If-Match malformed",
+			http.MethodPut,
+			http.Header{"If-Match": {`a`}},
+			`"a"`,
+			modified,
+			http.StatusPreconditionFailed,
+		},
+		{
+			"If-Unmodified-Since after the modification",
+			http.MethodPut,
+			http.Header{"If-Unmodified-Since": {after}},
+			`"a"`,
+			modified,
+			0,
+		},
+		{
+			"If-Unmodified-Since before the modification",
+			http.MethodPut,
+			http.Header{"If-Unmodified-Since": {before}},
+			`"a"`,
+			modified,
+			http.StatusPreconditionFailed,
+		},
+		{
+			"If-Match takes precedence over If-Unmodified-Since",
+			http.MethodPut,
+			http.Header{"If-Match": {`"a"`}, "If-Unmodified-Since": {before}},
+			`"a"`,
+			modified,
+			0,
+		},
+		{
+			"If-Modified-Since at the modification",
+			http.MethodGet,
+			http.Header{"If-Modified-Since": {at}},
+			`"a"`,
+			modified.Add(500 * time.Millisecond),
+			http.StatusNotModified,
+		},
+		{
+			"If-Modified-Since before the modification",
+			http.MethodGet,
+			http.Header{"If-Modified-Since": {before}},
+			`"a"`,
+			modified,
+			0,
+		},
+		{
+			"If-Modified-Since invalid",
+			http.MethodGet,
+			http.Header{"If-Modified-Since": {"yesterday"}},
+			`"a"`,
+			modified,
+			0,
+		},
+		{
+			"If-Modified-Since ignored for unsafe methods",
+			http.MethodPost,
+			http.Header{"If-Modified-Since": {after}},
+			`"a"`,
+			modified,
+			0,
+		},
+		{
+			"If-None-Match takes precedence over If-Modified-Since",
+			http.MethodGet,
+			http.Header{"If-None-Match": {`"b"`}, "If-Modified-Since": {after}},
+			`"a"`,
+			modified,
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			req := httptest.NewRequest(test.method, "http://foo.com/", nil)
+			req.Header = test.header
+			respRec := httptest.NewRecorder()
+
+			done := middleware.CheckPreconditions(respRec, req, test.etag, test.lastModified)
+			assert.Equal(test.expectedStatus != 0, done)
+
+			if done {
+				assert.Equal(test.expectedStatus, respRec.Code)
+			}
+		})
+	}
+}
+
+func TestEtagWithOptionsPreconditions(t *testing.T) {
+	modified := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	handler := middleware.EtagWithOptions(middleware.EtagOptions{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middleware.SetLastModified(w, modified)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("foo"))
+		}),
+	)
+
+	tests := []struct {
+		name           string
+		header         http.Header
+		expectedStatus int
+	}{
+		{"no conditions", http.Header{}, http.StatusOK},
+		{
+			"not modified since",
+			http.Header{"If-Modified-Since": {modified.Format(http.TimeFormat)}},
+			http.StatusNotModified,
+		},
+		{
+			"modified since",
+			http.Header{"If-Modified-Since": {modified.Add(-time.Second).Format(http.TimeFormat)}},
+			http.StatusOK,
+		},
+		{"If-Match does not match", http.Header{"If-Match": {`"foo"`}}, http.StatusPreconditionFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			req := httptest.NewRequest(http.MethodGet, "http://foo.com/", nil)
+			req.Header = test.header
+			respRec := httptest.NewRecorder()
+
+			handler.ServeHTTP(respRec, req)
+
+			assert.Equal(test.expectedStatus, respRec.Code)
+			assert.Equal(modified.Format(http.TimeFormat), respRec.Header().Get("Last-Modified"))
+
+			if test.expectedStatus == http.StatusNotModified {
+				assert.Empty(respRec.Header().Get("Content-Type"))
+				assert.Empty(respRec.Body.String())
+			}
+		})
+	}
+}
@@ -1,13 +1,20 @@
 package middleware
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/nickhstr/goweb/etag"
 )
 
 // EtagWriter provides a ResponseWriter which holds info needed for verifying etags.
+// ETags are computed per call to Write; see EtagWithOptions for ETags of
+// whole responses.
 type EtagWriter struct {
 	http.ResponseWriter
 	clientEtag string
@@ -32,7 +39,7 @@ func (e *EtagWriter) ClientEtag(t string) *EtagWriter {
 func (e *EtagWriter) Write(p []byte) (int, error) {
 	rw, ok := e.ResponseWriter.(middleware.WrapResponseWriter)
 	if !ok {
-		return e.Write(p)
+		return e.ResponseWriter.Write(p)
 	}
 
 	// Don't generate etag for error status codes
@@ -46,7 +53,7 @@ func (e *EtagWriter) Write(p []byte) (int, error) {
 	et := etag.Generate(p, weak)
 	rw.Header().Set("ETag", et)
 
-	if e.clientEtag == et {
+	if matchesETag(e.clientEtag, et, true, true) {
 		// Set status to not modified, and return
 		rw.WriteHeader(http.StatusNotModified)
 		return 0, nil
@@ -56,6 +63,8 @@ func (e *EtagWriter) Write(p []byte) (int, error) {
 }
 
 // Etag middleware sets the ETag header.
+// The ETag is computed per call to Write, so is only correct for handlers
+// which write their response at once; EtagWithOptions handles any handler.
 func Etag(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		e := NewEtagWriter(w).ClientEtag(r.Header.Get("If-None-Match"))
@@ -63,3 +72,200 @@ func Etag(next http.Handler) http.Handler {
 		next.ServeHTTP(e, r)
 	})
 }
+
+// EtagOptions are the configurable options for the EtagWithOptions
+// middleware.
+type EtagOptions struct {
+	// MaxBufferSize is the size of the largest response body buffered to
+	// compute its ETag. Larger responses are streamed without an ETag.
+	// Default is: 1MB.
+	MaxBufferSize int
+
+	// Weak makes ETags weak, for responses whose bodies are equivalent,
+	// but not byte for byte identical, between requests.
+	// Default is: false.
+	Weak bool
+
+	// Hash is the hash function of ETags. Non-cryptographic hashes, e.g.
+	// etag.XXHash, are faster for large bodies.
+	// Default is: etag.SHA1.
+	Hash etag.Hash
+}
+
+// withDefaults returns a copy of the options with defaults applied.
+func (o EtagOptions) withDefaults() EtagOptions {
+	if o.MaxBufferSize == 0 {
+		o.MaxBufferSize = 1 << 20
+	}
+
+	return o
+}
+
+// EtagWithOptions middleware sets the ETag header of successful responses,
+// computed over their whole body, which is buffered, and evaluates the
+// conditional headers of GET and HEAD requests (RFC 7232) against it, and
+// any Last-Modified header set by the handler (see SetLastModified),
+// replying 304 (Not Modified) or 412 (Precondition Failed).
+// Handlers which set their own ETag header keep it. Handlers which flush,
+// or whose responses exceed the buffer size, are streamed without an ETag.
+func EtagWithOptions(opts EtagOptions) Middleware {
+	opts = opts.withDefaults()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bw := &bufferedEtagWriter{
+				ResponseWriter: w,
+				opts:           opts,
+				gen:            etag.New(etag.Options{Hash: opts.Hash, Weak: opts.Weak}),
+			}
+
+			next.ServeHTTP(bw, r)
+			bw.finish(r)
+		})
+	}
+}
+
+// bufferedEtagWriter buffers a response, until its ETag is computed by
+// finish, unless the response is streamed.
+type bufferedEtagWriter struct {
+	http.ResponseWriter
+	opts EtagOptions
+
+	status    int
+	buf       bytes.Buffer
+	gen       *etag.Generator
+	streaming bool
+}
+
+func (bw *bufferedEtagWriter) WriteHeader(status int) {
+	if bw.streaming {
+		bw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if bw.status == 0 {
+		bw.status = status
+	}
+}
+
+func (bw *bufferedEtagWriter) Write(p []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+
+	if !bw.streaming && bw.buf.Len()+len(p) > bw.opts.MaxBufferSize {
+		if err := bw.stream(); err != nil {
+			return 0, err
+		}
+	}
+
+	if bw.streaming {
+		return bw.ResponseWriter.Write(p)
+	}
+
+	_, _ = bw.gen.Write(p)
+
+	return bw.buf.Write(p)
+}
+
+// Flush streams the response, as the handler wants it sent as it is
+// written.
+func (bw *bufferedEtagWriter) Flush() {
+	if !bw.streaming {
+		if bw.status == 0 {
+			bw.status = http.StatusOK
+		}
+
+		if err := bw.stream(); err != nil {
+			return
+		}
+	}
+
+	if f, ok := bw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, e.g. for WebSockets,
+// whose data is neither buffered nor tagged.
+func (bw *bufferedEtagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := bw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: ResponseWriter does not implement http.Hijacker")
+	}
+
+	bw.streaming = true
+
+	return hj.Hijack()
+}
+
+// stream writes the header and buffered body, without an ETag; later
+// writes are passed through.
+func (bw *bufferedEtagWriter) stream() error {
+	bw.streaming = true
+	bw.ResponseWriter.WriteHeader(bw.status)
+
+	_, err := bw.buf.WriteTo(bw.ResponseWriter)
+
+	return err
+}
+
+// finish writes the buffered response, with its ETag, or the 304 (Not
+// Modified) or 412 (Precondition Failed) response its preconditions call
+// for.
+func (bw *bufferedEtagWriter) finish(r *http.Request) {
+	if bw.streaming {
+		return
+	}
+
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+
+	h := bw.Header()
+
+	// handlers of HEAD requests need not write the body, whose ETag and
+	// length are then unknown; those of an empty body would contradict
+	// the GET response's
+	bodiless := r.Method == http.MethodHead && bw.buf.Len() == 0
+
+	if tagged(bw.status) && h.Get("ETag") == "" && !bodiless {
+		h.Set("ETag", bw.gen.ETag())
+	}
+
+	// preconditions are evaluated for successful responses of safe methods
+	// only; handlers of unsafe methods check them beforehand, with
+	// CheckPreconditions
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if safe && bw.status >= http.StatusOK && bw.status < http.StatusMultipleChoices {
+		lastModified, _ := parseHTTPTime(h.Get("Last-Modified"))
+
+		switch evaluatePreconditions(r, h.Get("ETag"), lastModified, true) {
+		case preconditionNotModified:
+			writeNotModified(bw.ResponseWriter)
+			return
+
+		case preconditionFailed:
+			h.Del("Content-Length")
+			bw.ResponseWriter.WriteHeader(http.StatusPreconditionFailed)
+
+			return
+		}
+	}
+
+	if h.Get("Content-Length") == "" && !bodiless &&
+		bw.status != http.StatusNoContent && bw.status != http.StatusNotModified {
+		h.Set("Content-Length", strconv.Itoa(bw.buf.Len()))
+	}
+
+	bw.ResponseWriter.WriteHeader(bw.status)
+	_, _ = bw.buf.WriteTo(bw.ResponseWriter)
+}
+
+// tagged reports whether responses with the status are given an ETag.
+func tagged(status int) bool {
+	return status >= http.StatusOK &&
+		status < http.StatusMultipleChoices &&
+		status != http.StatusNoContent &&
+		status != http.StatusPartialContent
+}
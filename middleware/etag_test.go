@@ -115,3 +115,227 @@ func TestEtag(t *testing.T) {
 		})
 	}
 }
+
+func TestEtagWriterUnwrapped(t *testing.T) {
+	respRec := httptest.NewRecorder()
+	e := &middleware.EtagWriter{ResponseWriter: respRec}
+
+	n, err := e.Write([]byte("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "foo", respRec.Body.String())
+}
+
+func TestEtagWithOptions(t *testing.T) {
+	body := "all good here"
+	tag := etag.Generate([]byte(body), false)
+
+	xx := etag.New(etag.Options{Hash: etag.XXHash})
+	xx.Write([]byte(body))
+	xxTag := xx.ETag()
+
+	multiWrite := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("all good "))
+		w.Header().Set("X-Set-Late", "true")
+		w.Write([]byte("here"))
+	})
+
+	tests := []struct {
+		name           string
+		opts           middleware.EtagOptions
+		method         string
+		ifNoneMatch    string
+		handler        http.Handler
+		expectedStatus int
+		expectedEtag   string
+		expectedBody   string
+	}{
+		{
+			"should tag the whole body",
+			middleware.EtagOptions{},
+			http.MethodGet,
+			"",
+			multiWrite,
+			http.StatusOK,
+			tag,
+			body,
+		},
+		{
+			"should make weak tags",
+			middleware.EtagOptions{Weak: true},
+			http.MethodGet,
+			"",
+			multiWrite,
+			http.StatusOK,
+			etag.Generate([]byte(body), true),
+			body,
+		},
+		{
+			"should tag with the hash function",
+			middleware.EtagOptions{Hash: etag.XXHash},
+			http.MethodGet,
+			"",
+			multiWrite,
+			http.StatusOK,
+			xxTag,
+			body,
+		},
+		{
+			"should reply not modified to a matching tag",
+			middleware.EtagOptions{},
+			http.MethodGet,
+			tag,
+			multiWrite,
+			http.StatusNotModified,
+			tag,
+			"",
+		},
+		{
+			"should not reply not modified to unsafe methods",
+			middleware.EtagOptions{},
+			http.MethodPost,
+			tag,
+			multiWrite,
+			http.StatusOK,
+			tag,
+			body,
+		},
+		{
+			"should not tag errors",
+			middleware.EtagOptions{},
+			http.MethodGet,
+			"",
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("not found"))
+			}),
+			http.StatusNotFound,
+			"",
+			"not found",
+		},
+		{
+			"should keep the handler's tag",
+			middleware.EtagOptions{},
+			http.MethodGet,
+			`"v1"`,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"v1"`)
+				w.Write([]byte(body))
+			}),
+			http.StatusNotModified,
+			`"v1"`,
+			"",
+		},
+		{
+			"should stream large bodies without a tag",
+			middleware.EtagOptions{MaxBufferSize: 10},
+			http.MethodGet,
+			"",
+			multiWrite,
+			http.StatusOK,
+			"",
+			body,
+		},
+		{
+			"should stream flushed bodies without a tag",
+			middleware.EtagOptions{},
+			http.MethodGet,
+			"",
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("all good "))
+				w.(http.Flusher).Flush()
+				w.Write([]byte("here"))
+			}),
+			http.StatusOK,
+			"",
+			body,
+		},
+		{
+			"should tag HEAD responses with a body",
+			middleware.EtagOptions{},
+			http.MethodHead,
+			"",
+			multiWrite,
+			http.StatusOK,
+			tag,
+			body,
+		},
+		{
+			"should not tag HEAD responses without a body",
+			middleware.EtagOptions{},
+			http.MethodHead,
+			"",
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+			http.StatusOK,
+			"",
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			handler := middleware.EtagWithOptions(test.opts)(test.handler)
+			respRec := httptest.NewRecorder()
+
+			req := httptest.NewRequest(test.method, "http://foo.com/", nil)
+			if test.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+
+			handler.ServeHTTP(respRec, req)
+			resp := respRec.Result()
+
+			assert.Equal(test.expectedStatus, resp.StatusCode)
+			assert.Equal(test.expectedEtag, resp.Header.Get("ETag"))
+			assert.Equal(test.expectedBody, respRec.Body.String())
+		})
+	}
+
+	t.Run("should include headers set after the first write", func(t *testing.T) {
+		respRec := httptest.NewRecorder()
+		middleware.EtagWithOptions(middleware.EtagOptions{})(multiWrite).
+			ServeHTTP(respRec, httptest.NewRequest(http.MethodGet, "http://foo.com/", nil))
+
+		assert.Equal(t, "true", respRec.Result().Header.Get("X-Set-Late"))
+		assert.Equal(t, "13", respRec.Result().Header.Get("Content-Length"))
+	})
+
+	t.Run("should not set the length of HEAD responses without a body", func(t *testing.T) {
+		respRec := httptest.NewRecorder()
+		middleware.EtagWithOptions(middleware.EtagOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(respRec, httptest.NewRequest(http.MethodHead, "http://foo.com/", nil))
+
+		_, ok := respRec.Result().Header["Content-Length"]
+		assert.False(t, ok)
+	})
+
+	t.Run("should let handlers hijack the connection", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := httptest.NewServer(middleware.EtagWithOptions(middleware.EtagOptions{})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, buf, err := w.(http.Hijacker).Hijack()
+				if !assert.Nil(err) {
+					return
+				}
+				defer conn.Close()
+
+				buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+				buf.Flush()
+			}),
+		))
+		defer srv.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+
+		resp, err := http.DefaultClient.Do(req)
+		if assert.Nil(err) {
+			resp.Body.Close()
+			assert.Equal(http.StatusSwitchingProtocols, resp.StatusCode)
+		}
+	})
+}
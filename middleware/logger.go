@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/nickhstr/goweb/logger"
+	"github.com/nickhstr/goweb/requestid"
 )
 
 // LoggerOptions holds all logger middleware options.
@@ -25,14 +26,19 @@ func Logger(opts LoggerOptions) Middleware {
 			start := time.Now()
 
 			// add logger to request's context
-			l := log.With().
+			lc := log.With().
 				Str("method", r.Method).
 				Str("url", r.URL.String()).
 				Str("host", r.Host).
 				Interface("requestHeaders", r.Header).
 				Str("appName", opts.Name).
-				Str("gitRevision", opts.GitCommit).
-				Logger()
+				Str("gitRevision", opts.GitCommit)
+
+			if id, ok := requestid.FromContext(r.Context()); ok {
+				lc = lc.Str("requestID", id)
+			}
+
+			l := lc.Logger()
 			r = r.WithContext(l.WithContext(r.Context()))
 
 			next.ServeHTTP(ww, r)
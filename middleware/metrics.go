@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsOptions configures the Metrics middleware.
+type MetricsOptions struct {
+	// Namespace prefixes all metric names.
+	// Default is: no prefix.
+	Namespace string
+
+	// DurationBuckets are the histogram buckets for request durations,
+	// in seconds.
+	// Default is: prometheus.DefBuckets.
+	DurationBuckets []float64
+
+	// SizeBuckets are the histogram buckets for response sizes, in bytes.
+	// Default is: exponential buckets from 100B to 10MB.
+	SizeBuckets []float64
+
+	// Registerer registers the metrics' collectors.
+	// Default is: prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+
+	// RouteName returns the route label for a request. It should return a
+	// route template (e.g. "/users/{id}"), not the raw URL path, to avoid
+	// unbounded label cardinality.
+	// Default is: a function returning "unknown".
+	RouteName func(*http.Request) string
+}
+
+// metrics holds the RED metrics' collectors.
+type metrics struct {
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+	responseSize *prometheus.HistogramVec
+}
+
+func newMetrics(opts MetricsOptions) *metrics {
+	labels := []string{"method", "route", "status"}
+
+	m := &metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests, in seconds.",
+			Buckets:   opts.DurationBuckets,
+		}, labels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: opts.Namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests currently being served.",
+		}, []string{"method", "route"}),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      "http_response_size_bytes",
+			Help:      "Size of HTTP responses, in bytes.",
+			Buckets:   opts.SizeBuckets,
+		}, labels),
+	}
+
+	m.requests = register(opts.Registerer, m.requests).(*prometheus.CounterVec)
+	m.duration = register(opts.Registerer, m.duration).(*prometheus.HistogramVec)
+	m.inFlight = register(opts.Registerer, m.inFlight).(*prometheus.GaugeVec)
+	m.responseSize = register(opts.Registerer, m.responseSize).(*prometheus.HistogramVec)
+
+	return m
+}
+
+// register registers the collector, returning the already registered
+// collector if an identical one exists. This allows the middleware to be
+// created more than once with the same Registerer.
+func register(reg prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	err := reg.Register(c)
+	if err == nil {
+		return c
+	}
+
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		return are.ExistingCollector
+	}
+
+	panic(err)
+}
+
+// statusClass groups status codes by class, e.g. "2xx", to keep label
+// cardinality low.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// methodLabel returns the request method as a label value. Clients may
+// send any method, so non-standard methods are grouped as "OTHER", to keep
+// label cardinality bounded.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet,
+		http.MethodHead,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+		http.MethodConnect,
+		http.MethodOptions,
+		http.MethodTrace:
+		return method
+	}
+
+	return "OTHER"
+}
+
+// Metrics records RED (rate, errors, duration) metrics for requests with
+// Prometheus: request count, duration, in-flight requests and response size,
+// labeled by method, route and status class.
+func Metrics(opts MetricsOptions) Middleware {
+	if len(opts.DurationBuckets) == 0 {
+		opts.DurationBuckets = prometheus.DefBuckets
+	}
+
+	if len(opts.SizeBuckets) == 0 {
+		opts.SizeBuckets = prometheus.ExponentialBuckets(100, 10, 6)
+	}
+
+	if opts.Registerer == nil {
+		opts.Registerer = prometheus.DefaultRegisterer
+	}
+
+	if opts.RouteName == nil {
+		opts.RouteName = func(*http.Request) string { return "unknown" }
+	}
+
+	m := newMetrics(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := opts.RouteName(r)
+			method := methodLabel(r.Method)
+			ww := middleware.NewWrapResponseWriter(w, 0)
+			start := time.Now()
+
+			inFlight := m.inFlight.WithLabelValues(method, route)
+			inFlight.Inc()
+
+			defer func() {
+				inFlight.Dec()
+
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				labels := prometheus.Labels{
+					"method": method,
+					"route":  route,
+					"status": statusClass(status),
+				}
+
+				m.requests.With(labels).Inc()
+				m.duration.With(labels).Observe(time.Since(start).Seconds())
+				m.responseSize.With(labels).Observe(float64(ww.BytesWritten()))
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
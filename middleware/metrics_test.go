@@ -0,0 +1,130 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nickhstr/goweb/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		expectedStatus string
+	}{
+		{
+			"successful response should be counted as 2xx",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			},
+			"2xx",
+		},
+		{
+			"server error should be counted as 5xx",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			"5xx",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			reg := prometheus.NewRegistry()
+			mw := middleware.Metrics(middleware.MetricsOptions{
+				Namespace:  "test",
+				Registerer: reg,
+				RouteName:  func(*http.Request) string { return "/users/{id}" },
+			})
+			handler := mw(test.handler)
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/2", nil))
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counts := map[string]float64{}
+
+			for _, f := range families {
+				if f.GetName() != "test_http_requests_total" {
+					continue
+				}
+
+				for _, m := range f.GetMetric() {
+					labels := map[string]string{}
+					for _, l := range m.GetLabel() {
+						labels[l.GetName()] = l.GetValue()
+					}
+
+					assert.Equal(http.MethodGet, labels["method"])
+					assert.Equal("/users/{id}", labels["route"])
+					counts[labels["status"]] += m.GetCounter().GetValue()
+				}
+			}
+
+			assert.Equal(map[string]float64{test.expectedStatus: 2}, counts)
+		})
+	}
+}
+
+func TestMetricsMethods(t *testing.T) {
+	assert := assert.New(t)
+	reg := prometheus.NewRegistry()
+	handler := middleware.Metrics(middleware.MetricsOptions{
+		Namespace:  "test",
+		Registerer: reg,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, method := range []string{http.MethodGet, http.MethodPatch, "FOO", "BAR"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/", nil))
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]float64{}
+
+	for _, f := range families {
+		if f.GetName() != "test_http_requests_total" {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "method" {
+					counts[l.GetValue()] += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	assert.Equal(map[string]float64{http.MethodGet: 1, http.MethodPatch: 1, "OTHER": 2}, counts)
+}
+
+func TestMetricsRegistersOnce(t *testing.T) {
+	assert := assert.New(t)
+	reg := prometheus.NewRegistry()
+	opts := middleware.MetricsOptions{Registerer: reg}
+
+	assert.NotPanics(func() {
+		middleware.Metrics(opts)
+		middleware.Metrics(opts)
+	})
+
+	handler := middleware.Metrics(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	families, err := reg.Gather()
+	assert.Nil(err)
+	assert.Len(families, 4)
+}
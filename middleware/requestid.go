@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/nickhstr/goweb/requestid"
+)
+
+// RequestID middleware accepts a request ID from the incoming request's
+// X-Request-ID header, or generates one if none (or an invalid one) was
+// supplied.
+// The ID is added to the request's context and the response's headers.
+// Place RequestID before Logger, so that every log line includes the ID.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		w.Header().Set(requestid.Header, id)
+		r = r.WithContext(requestid.NewContext(r.Context(), id))
+
+		next.ServeHTTP(w, r)
+	})
+}
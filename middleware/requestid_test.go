@@ -0,0 +1,65 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nickhstr/goweb/middleware"
+	"github.com/nickhstr/goweb/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name       string
+		incomingID string
+		shouldKeep bool
+	}{
+		{
+			"supplied request ID should be propagated",
+			"abc-123",
+			true,
+		},
+		{
+			"missing request ID should be generated",
+			"",
+			false,
+		},
+		{
+			"invalid request ID should be replaced",
+			"not valid",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var ctxID string
+
+			handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID, _ = requestid.FromContext(r.Context())
+			}))
+			respRec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			if test.incomingID != "" {
+				req.Header.Set(requestid.Header, test.incomingID)
+			}
+
+			handler.ServeHTTP(respRec, req)
+			respID := respRec.Result().Header.Get(requestid.Header)
+
+			assert.NotEmpty(respID)
+			assert.Equal(respID, ctxID)
+
+			if test.shouldKeep {
+				assert.Equal(test.incomingID, respID)
+			} else {
+				assert.NotEqual(test.incomingID, respID)
+			}
+		})
+	}
+}
@@ -1,32 +1,54 @@
 // Package newrelic allows for simple to use New Relic agent configuration.
 // Standard New Relic environment variable names are used for much of
 // the agent's configuration.
+// Call Setup to create the application and use it for the instrument
+// package's transactions.
 // Logging is done via the github.com/TheWeatherCompany/packages/go/logger
 // package.
 package newrelic
 
 import (
+	"fmt"
 	"net/http"
-	"os"
+	"sync"
 
+	"github.com/newrelic/go-agent/v3/integrations/nrredis-v7"
 	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/nickhstr/goweb/cache/redis"
+	"github.com/nickhstr/goweb/instrument"
 	"github.com/nickhstr/goweb/logger"
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 )
 
-var app *newrelic.Application
+var (
+	app *newrelic.Application
+	mu  = &sync.Mutex{}
+)
 
 func init() {
 	viper.SetDefault("NEW_RELIC_ENABLED", "false")
 	viper.SetDefault("NEW_RELIC_LOG_ENABLED", "false")
 	viper.SetDefault("NEW_RELIC_LOG_LEVEL", "error")
+}
+
+// Setup creates the New Relic application from its environment variables,
+// installs it as the instrument package's Instrumenter, and instruments
+// Redis clients subsequently created by cache/redis.
+// Calling Setup more than once returns the application created by the
+// first successful call.
+func Setup() (*newrelic.Application, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if app != nil {
+		return app, nil
+	}
 
 	enabled := viper.GetBool("NEW_RELIC_ENABLED")
 	appName := viper.GetString("NEW_RELIC_APP_NAME")
 	license := viper.GetString("NEW_RELIC_LICENSE_KEY")
 	logEnabled := viper.GetBool("NEW_RELIC_LOG_ENABLED")
-	log := logger.New("newrelic")
 
 	configOptions := []newrelic.ConfigOption{
 		newrelic.ConfigEnabled(enabled),
@@ -42,17 +64,24 @@ func init() {
 		configOptions = append(configOptions, newrelic.ConfigLogger(l))
 	}
 
-	var err error
-	if app, err = newrelic.NewApplication(configOptions...); err != nil {
-		log.Error().
-			Err(err).
-			Msg("failed to create newrelic application")
-		os.Exit(1)
+	a, err := newrelic.NewApplication(configOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("newrelic: failed to create application: %w", err)
 	}
+
+	app = a
+	instrument.Set(NewInstrumenter(app))
+	redis.RegisterHook(nrredis.NewHook)
+
+	return app, nil
 }
 
 // App provides access to the newrelic application instance.
+// It is nil until Setup has succeeded.
 func App() *newrelic.Application {
+	mu.Lock()
+	defer mu.Unlock()
+
 	return app
 }
 
@@ -68,6 +97,59 @@ func Handler(h http.Handler, path string) http.Handler {
 	return h
 }
 
+// Instrumenter satisfies instrument.Instrumenter, recording transactions
+// with a New Relic application.
+type Instrumenter struct {
+	app *newrelic.Application
+}
+
+// NewInstrumenter returns an Instrumenter for the given application.
+func NewInstrumenter(app *newrelic.Application) *Instrumenter {
+	return &Instrumenter{app}
+}
+
+// StartTransaction starts a New Relic web transaction for the request.
+func (i *Instrumenter) StartTransaction(
+	name string,
+	w http.ResponseWriter,
+	r *http.Request,
+) (instrument.Transaction, http.ResponseWriter, *http.Request) {
+	txn := i.app.StartTransaction(name)
+	txn.SetWebRequestHTTP(r)
+	w = txn.SetWebResponse(w)
+	r = newrelic.RequestWithTransactionContext(r, txn)
+
+	return &transaction{txn}, w, r
+}
+
+// transaction adapts a New Relic transaction to instrument.Transaction.
+type transaction struct {
+	txn *newrelic.Transaction
+}
+
+func (t *transaction) AddAttribute(key string, value interface{}) {
+	t.txn.AddAttribute(key, value)
+}
+
+func (t *transaction) End() {
+	t.txn.End()
+}
+
+func (t *transaction) NoticeError(err error) {
+	t.txn.NoticeError(err)
+}
+
+func (t *transaction) SetName(name string) {
+	t.txn.SetName(name)
+}
+
+func (t *transaction) StartSegment(name string) instrument.Segment {
+	return t.txn.StartSegment(name)
+}
+
+// sanity check for satisfaction of Instrumenter interface
+var _ instrument.Instrumenter = &Instrumenter{}
+
 type nrLogger struct {
 	log zerolog.Logger
 }
@@ -0,0 +1,59 @@
+// Package requestid provides helpers for generating and propagating request
+// IDs, so that log lines and errors can be correlated across services.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Header is the HTTP header used to send and receive request IDs.
+const Header = "X-Request-ID"
+
+// maxLength is the longest request ID accepted from a client. Longer values
+// are replaced, to keep log lines and headers reasonably sized.
+const maxLength = 128
+
+// requestIDContextKey is the context key under which the request ID is stored.
+type requestIDContextKey struct{}
+
+var ridKey = requestIDContextKey{}
+
+// New generates a new random request ID.
+func New() string {
+	b := make([]byte, 16)
+
+	// crypto/rand.Read only fails if the system's randomness source is
+	// unavailable, in which case the zeroed bytes are still a usable ID
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether id is acceptable as a request ID.
+// Only non-empty, printable ASCII values of limited length are allowed.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewContext returns a copy of parent which carries the request ID.
+func NewContext(parent context.Context, id string) context.Context {
+	return context.WithValue(parent, ridKey, id)
+}
+
+// FromContext returns the request ID stored in ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ridKey).(string)
+	return id, ok && id != ""
+}
@@ -0,0 +1,51 @@
+package requestid_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nickhstr/goweb/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	id := requestid.New()
+	assert.Len(id, 32)
+	assert.True(requestid.Valid(id))
+	assert.NotEqual(id, requestid.New())
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		expected bool
+	}{
+		{"empty id should be invalid", "", false},
+		{"simple id should be valid", "abc-123", true},
+		{"id with spaces should be invalid", "abc 123", false},
+		{"id with control characters should be invalid", "abc\n123", false},
+		{"overly long id should be invalid", strings.Repeat("a", 129), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, requestid.Valid(test.id))
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	assert := assert.New(t)
+
+	_, ok := requestid.FromContext(context.Background())
+	assert.False(ok)
+
+	ctx := requestid.NewContext(context.Background(), "abc123")
+	id, ok := requestid.FromContext(ctx)
+	assert.True(ok)
+	assert.Equal("abc123", id)
+}
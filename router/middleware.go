@@ -3,11 +3,12 @@ package router
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"net/http"
 
-	"github.com/gorilla/handlers"
-	"github.com/newrelic/go-agent/v3/integrations/nrgorilla"
+	"github.com/gorilla/mux"
+	"github.com/nickhstr/goweb/instrument"
 	"github.com/nickhstr/goweb/middleware"
-	"github.com/nickhstr/goweb/newrelic"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/cors"
 	"github.com/spf13/viper"
 )
@@ -31,14 +32,27 @@ type AuthOptions struct {
 	WhiteList []string
 }
 
+// MetricsOptions are options for the Prometheus metrics of Metrics.
+type MetricsOptions struct {
+	// DurationBuckets are the request duration histogram buckets, in
+	// seconds.
+	DurationBuckets []float64
+	// Registerer registers the metrics' collectors.
+	Registerer prometheus.Registerer
+}
+
 // DefaultMiddleware provides a configurable default middleware stack for
 // a router.
+// Requests are recorded as transactions by the instrument package's
+// Instrumenter, which is a no-op unless one has been installed (see
+// telemetry.Setup).
 // This middleware is intended only to be used for routes matched by the router.
+// For request metrics, which should include unmatched requests, see Metrics.
 // For middleware that's not limited to the router's scope, see middleware.Compose
 // for adding middleware to an http.Handler.
 func DefaultMiddleware(opts DefaultMiddlewareOptions) []middleware.Middleware {
 	mw := []middleware.Middleware{
-		nrgorilla.Middleware(newrelic.App()),
+		instrument.Middleware(routeName),
 		middleware.SecureDefault(),
 		middleware.AppHeaders(middleware.AppHeadersOptions{
 			GitCommit: opts.GitCommit,
@@ -58,12 +72,14 @@ func DefaultMiddleware(opts DefaultMiddlewareOptions) []middleware.Middleware {
 		}))
 	}
 
-	if opts.ETag {
-		mw = append(mw, middleware.Etag)
+	// compression wraps the ETag middleware, so that ETags are computed over
+	// uncompressed bodies
+	if opts.Compress {
+		mw = append(mw, middleware.Compress(middleware.CompressOptions{}))
 	}
 
-	if opts.Compress {
-		mw = append(mw, handlers.CompressHandler)
+	if opts.ETag {
+		mw = append(mw, middleware.EtagWithOptions(middleware.EtagOptions{}))
 	}
 
 	if opts.CORS {
@@ -72,3 +88,46 @@ func DefaultMiddleware(opts DefaultMiddlewareOptions) []middleware.Middleware {
 
 	return mw
 }
+
+// Metrics wraps the router with Prometheus request metrics (see
+// middleware.Metrics), labeled by route template.
+// Unlike middleware added with the router's Use method, which only sees
+// requests matching a route, every request the router serves is recorded;
+// those matching no route, or none of the methods of the routes matching
+// their path, are labeled with the "unmatched" route.
+func Metrics(r *mux.Router, opts MetricsOptions) http.Handler {
+	return middleware.Metrics(middleware.MetricsOptions{
+		DurationBuckets: opts.DurationBuckets,
+		Registerer:      opts.Registerer,
+		RouteName: func(req *http.Request) string {
+			var match mux.RouteMatch
+			if !r.Match(req, &match) || match.MatchErr != nil || match.Route == nil {
+				return "unmatched"
+			}
+
+			if tmpl, err := match.Route.GetPathTemplate(); err == nil {
+				return tmpl
+			}
+
+			return "unknown"
+		},
+	})(r)
+}
+
+// routeTemplate returns the path template of the request's matched route.
+// Route templates are used in place of raw URL paths, to keep the number of
+// distinct transaction names and metric labels low.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+
+	return "unknown"
+}
+
+// routeName names a request's transaction by its method and route template.
+func routeName(r *http.Request) string {
+	return r.Method + " " + routeTemplate(r)
+}
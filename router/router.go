@@ -28,6 +28,15 @@ type DefaultOptions struct {
 	// GitCommit is the git SHA of the app's current git commit.
 	GitCommit string
 
+	// Metrics, if set to true, records Prometheus request metrics for
+	// all requests served by DefaultMux, exposed by the "/metrics" route.
+	// Routers created by Default are wrapped with Metrics to record them.
+	Metrics bool
+
+	// MetricsBuckets are the request duration histogram buckets, in
+	// seconds. Defaults to prometheus.DefBuckets.
+	MetricsBuckets []float64
+
 	// Name is the application name.
 	Name string
 
@@ -95,8 +104,15 @@ func Default(routes []Route, opts DefaultOptions) *mux.Router {
 // some application-wide middleware.
 func DefaultMux(routes []Route, opts DefaultOptions) http.Handler {
 	r := Default(routes, opts)
-	h := middleware.Compose(
-		r,
+
+	var h http.Handler = r
+	if opts.Metrics {
+		h = Metrics(r, MetricsOptions{DurationBuckets: opts.MetricsBuckets})
+	}
+
+	h = middleware.Compose(
+		h,
+		middleware.RequestID,
 		middleware.Logger(middleware.LoggerOptions{
 			GitCommit: opts.GitCommit,
 			Name:      opts.Name,
@@ -87,3 +87,33 @@ func TestDefaultMux(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultMuxMetrics(t *testing.T) {
+	assert := assert.New(t)
+	routes := []router.Route{
+		func(r *mux.Router) {
+			r.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "aww yeah")
+			}).Methods(http.MethodGet)
+		},
+	}
+	r := router.DefaultMux(routes, router.DefaultOptions{
+		Metrics: true,
+		Name:    "test-app",
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/users/123", nil))
+
+	respRec := httptest.NewRecorder()
+	r.ServeHTTP(respRec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := respRec.Body.String()
+	assert.Contains(body, `http_requests_total{method="GET",route="/users/{id}",status="2xx"}`)
+	assert.NotContains(body, `route="/users/123"`)
+
+	// requests matching no route are counted too
+	assert.Contains(body, `http_requests_total{method="GET",route="unmatched",status="4xx"}`)
+	assert.Contains(body, `http_requests_total{method="DELETE",route="unmatched",status="4xx"}`)
+}
@@ -8,8 +8,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/newrelic/go-agent/v3/newrelic"
-	nr "github.com/nickhstr/goweb/newrelic"
+	"github.com/nickhstr/goweb/instrument"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -115,16 +114,16 @@ func DebugRoute(r *mux.Router) {
 	dr.HandleFunc("/trace", pprof.Trace)
 }
 
-// NotFound adds a NotFoundHandler to the router, instrumented by New Relic.
+// NotFound adds a NotFoundHandler to the router, instrumented by the
+// instrument package.
 func NotFound(r *mux.Router) {
-	_, handler := newrelic.WrapHandle(nr.App(), "NotFoundHandler", http.NotFoundHandler())
-	r.NotFoundHandler = handler
+	r.NotFoundHandler = instrument.Handler("NotFoundHandler", http.NotFoundHandler())
 }
 
-// MethodNotAllowed adds a MethodNotAllowedHandler to the router, instrumented by New Relic.
+// MethodNotAllowed adds a MethodNotAllowedHandler to the router, instrumented
+// by the instrument package.
 func MethodNotAllowed(r *mux.Router) {
-	_, handler := newrelic.WrapHandle(nr.App(), "MethodNotAllowedHandler", http.HandlerFunc(methodNotAllowed))
-	r.MethodNotAllowedHandler = handler
+	r.MethodNotAllowedHandler = instrument.Handler("MethodNotAllowedHandler", http.HandlerFunc(methodNotAllowed))
 }
 
 // methodNotAllowed replies to the request with an HTTP status code 405.
@@ -0,0 +1,55 @@
+// Package telemetry sets up the tracing provider selected by the
+// TRACING_PROVIDER config variable: "newrelic" (the default),
+// "opentelemetry" or "none".
+// Call Setup once at startup:
+//
+//	shutdown, err := telemetry.Setup(tracing.Options{ServiceName: "foo"})
+//	if err != nil {
+//		...
+//	}
+//	defer shutdown(context.Background())
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nickhstr/goweb/newrelic"
+	"github.com/nickhstr/goweb/tracing"
+)
+
+// Setup sets up the configured tracing provider, with newrelic.Setup or
+// tracing.Setup, given opts, installing it as the instrument package's
+// Instrumenter.
+// The returned function flushes any remaining data and shuts down the
+// provider; call it before the application exits.
+func Setup(opts tracing.Options) (func(context.Context) error, error) {
+	switch provider := tracing.Provider(); provider {
+	case tracing.ProviderNewRelic:
+		app, err := newrelic.Setup()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(ctx context.Context) error {
+			timeout := 10 * time.Second
+			if deadline, ok := ctx.Deadline(); ok {
+				timeout = time.Until(deadline)
+			}
+
+			app.Shutdown(timeout)
+
+			return nil
+		}, nil
+
+	case tracing.ProviderOpenTelemetry:
+		return tracing.Setup(opts)
+
+	case tracing.ProviderNone:
+		return func(context.Context) error { return nil }, nil
+
+	default:
+		return nil, fmt.Errorf("telemetry: unsupported tracing provider %q", provider)
+	}
+}
@@ -0,0 +1,67 @@
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nickhstr/goweb/instrument"
+	"github.com/nickhstr/goweb/telemetry"
+	"github.com/nickhstr/goweb/tracing"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name                 string
+		provider             string
+		expectedErr          bool
+		expectedInstrumenter instrument.Instrumenter
+	}{
+		{
+			"none should install nothing",
+			tracing.ProviderNone,
+			false,
+			instrument.Noop{},
+		},
+		{
+			"opentelemetry should install its Instrumenter",
+			tracing.ProviderOpenTelemetry,
+			false,
+			tracing.Instrumenter{},
+		},
+		{
+			"unsupported providers should error",
+			"foo",
+			true,
+			instrument.Noop{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			instrument.Set(instrument.Noop{})
+			viper.Set("TRACING_PROVIDER", test.provider)
+
+			defer func() {
+				viper.Set("TRACING_PROVIDER", tracing.ProviderNewRelic)
+				instrument.Set(instrument.Noop{})
+			}()
+
+			shutdown, err := telemetry.Setup(tracing.Options{
+				ServiceName: "test",
+				Exporter:    tracing.NewInMemoryExporter(),
+			})
+
+			if test.expectedErr {
+				assert.NotNil(err)
+			} else if assert.Nil(err) {
+				assert.Nil(shutdown(context.Background()))
+			}
+
+			assert.Equal(test.expectedInstrumenter, instrument.Get())
+		})
+	}
+}
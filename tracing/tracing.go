@@ -0,0 +1,281 @@
+// Package tracing provides OpenTelemetry-based tracing, as an alternative to
+// New Relic.
+// The TRACING_PROVIDER environment variable, which may be "newrelic" (the
+// default), "opentelemetry" or "none", selects the provider which
+// telemetry.Setup sets up.
+// When using OpenTelemetry, Setup installs the global tracer provider, W3C
+// trace context propagation, and the instrument package's Instrumenter.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/gorilla/mux"
+	"github.com/nickhstr/goweb/instrument"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this module's tracer.
+const instrumentationName = "github.com/nickhstr/goweb"
+
+// Supported tracing providers.
+const (
+	ProviderNewRelic      = "newrelic"
+	ProviderOpenTelemetry = "opentelemetry"
+	ProviderNone          = "none"
+)
+
+// Supported exporters, selected by TRACING_EXPORTER.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+)
+
+func init() {
+	viper.SetDefault("TRACING_PROVIDER", ProviderNewRelic)
+	viper.SetDefault("TRACING_EXPORTER", ExporterNone)
+}
+
+// Provider returns the configured tracing provider.
+// Nothing is instrumented until the chosen provider has been set up, with
+// telemetry.Setup.
+func Provider() string {
+	return viper.GetString("TRACING_PROVIDER")
+}
+
+// Options configures the OpenTelemetry tracer provider installed by Setup.
+type Options struct {
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+
+	// Exporter receives finished spans.
+	// If nil, the exporter is chosen by TRACING_EXPORTER: "stdout" writes
+	// spans to standard out, and "none" discards them.
+	Exporter sdktrace.SpanExporter
+
+	// Sampler decides which traces are recorded.
+	// Default is: parent-based, always sampling root spans.
+	Sampler sdktrace.Sampler
+
+	// Synchronous exports each span as soon as it ends, rather than in
+	// batches. Useful for tests.
+	Synchronous bool
+}
+
+// Setup installs a global OpenTelemetry tracer provider and W3C trace
+// context propagation, and installs Instrumenter as the instrument
+// package's Instrumenter.
+// The returned function flushes any remaining spans and shuts down the
+// provider; call it before the application exits.
+func Setup(opts Options) (func(context.Context) error, error) {
+	exporter := opts.Exporter
+
+	if exporter == nil {
+		var err error
+
+		exporter, err = exporterFromConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Sampler == nil {
+		opts.Sampler = sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(opts.ServiceName),
+	)
+
+	var export sdktrace.TracerProviderOption
+	if opts.Synchronous {
+		export = sdktrace.WithSyncer(exporter)
+	} else {
+		export = sdktrace.WithBatcher(exporter)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		export,
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(opts.Sampler),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	instrument.Set(Instrumenter{})
+
+	return tp.Shutdown, nil
+}
+
+func exporterFromConfig() (sdktrace.SpanExporter, error) {
+	name := viper.GetString("TRACING_EXPORTER")
+
+	switch name {
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterNone, "":
+		return tracetest.NewNoopExporter(), nil
+	default:
+		return nil, fmt.Errorf("tracing: unsupported exporter %q", name)
+	}
+}
+
+// NewInMemoryExporter returns an exporter which stores spans in memory,
+// for inspection in tests.
+func NewInMemoryExporter() *tracetest.InMemoryExporter {
+	return tracetest.NewInMemoryExporter()
+}
+
+// Tracer returns the tracer used for all of this module's spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Inject writes the trace context of ctx into the given headers, so
+// that traces continue in upstream services.
+func Inject(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// EndSpan records err, if any, on the span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Instrumenter satisfies instrument.Instrumenter, recording transactions
+// as OpenTelemetry server spans.
+type Instrumenter struct{}
+
+// StartTransaction starts a server span for the request, continuing any
+// incoming W3C trace context. The span's http.route attribute is the path
+// template of the request's matched gorilla/mux route, if any.
+func (Instrumenter) StartTransaction(
+	name string,
+	w http.ResponseWriter,
+	r *http.Request,
+) (instrument.Transaction, http.ResponseWriter, *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := Tracer().Start(
+		ctx,
+		name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", routeTemplate(r), r)...),
+	)
+	ww := middleware.NewWrapResponseWriter(w, 0)
+
+	return &transaction{ctx, span, ww}, ww, r.WithContext(ctx)
+}
+
+// transaction adapts a server span to instrument.Transaction.
+type transaction struct {
+	ctx  context.Context
+	span trace.Span
+	ww   middleware.WrapResponseWriter
+}
+
+func (t *transaction) AddAttribute(key string, value interface{}) {
+	t.span.SetAttributes(toAttribute(key, value))
+}
+
+func (t *transaction) End() {
+	status := t.ww.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	t.span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+
+	// Only server errors mark a server span as failed; 4xx responses
+	// are the client's fault
+	if status >= http.StatusInternalServerError {
+		t.span.SetStatus(codes.Error, http.StatusText(status))
+	}
+
+	t.span.End()
+}
+
+func (t *transaction) NoticeError(err error) {
+	t.span.RecordError(err)
+	t.span.SetStatus(codes.Error, err.Error())
+}
+
+func (t *transaction) SetName(name string) {
+	t.span.SetName(name)
+}
+
+func (t *transaction) StartSegment(name string) instrument.Segment {
+	_, span := Tracer().Start(t.ctx, name)
+	return segment{span}
+}
+
+// toAttribute converts a custom attribute value to its OpenTelemetry
+// attribute type. Unsupported types are recorded as strings.
+func toAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case string:
+		return attribute.String(key, v)
+	case fmt.Stringer:
+		return attribute.Stringer(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
+
+// segment adapts a child span to instrument.Segment.
+type segment struct {
+	span trace.Span
+}
+
+func (s segment) End() {
+	s.span.End()
+}
+
+// sanity check for satisfaction of Instrumenter interface
+var _ instrument.Instrumenter = Instrumenter{}
+
+// routeTemplate returns the path template of the request's matched route,
+// or an empty string if there is none.
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+
+	return tmpl
+}
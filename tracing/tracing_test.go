@@ -0,0 +1,165 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/nickhstr/goweb/instrument"
+	"github.com/nickhstr/goweb/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumenterRoutes(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	exporter := tracing.NewInMemoryExporter()
+	shutdown, err := tracing.Setup(tracing.Options{
+		ServiceName: "test",
+		Exporter:    exporter,
+		Synchronous: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = shutdown(context.Background()) }()
+	defer instrument.Set(nil)
+
+	tests := []struct {
+		name           string
+		path           string
+		traceparent    string
+		expectedName   string
+		expectedStatus codes.Code
+	}{
+		{
+			"span should be named by the route template",
+			"/users/123",
+			"",
+			"/users/{id}",
+			codes.Unset,
+		},
+		{
+			"span should continue an incoming trace",
+			"/users/123",
+			"00-" + traceID + "-00f067aa0ba902b7-01",
+			"/users/{id}",
+			codes.Unset,
+		},
+		{
+			"server errors should mark the span as failed",
+			"/error",
+			"",
+			"/error",
+			codes.Error,
+		},
+	}
+
+	r := mux.NewRouter()
+	r.Use(instrument.Middleware(func(r *http.Request) string {
+		tmpl, _ := mux.CurrentRoute(r).GetPathTemplate()
+		return r.Method + " " + tmpl
+	}))
+	r.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	r.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			exporter.Reset()
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.traceparent != "" {
+				req.Header.Set("traceparent", test.traceparent)
+			}
+
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := exporter.GetSpans()
+			if !assert.Len(spans, 1) {
+				return
+			}
+
+			span := spans[0]
+			assert.Equal("GET "+test.expectedName, span.Name)
+			assert.Contains(span.Attributes, semconv.HTTPRouteKey.String(test.expectedName))
+			assert.Equal(trace.SpanKindServer, span.SpanKind)
+			assert.Equal(test.expectedStatus, span.Status.Code)
+
+			if test.traceparent != "" {
+				assert.Equal(traceID, span.SpanContext.TraceID().String())
+			}
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	assert := assert.New(t)
+
+	shutdown, err := tracing.Setup(tracing.Options{
+		Exporter:    tracing.NewInMemoryExporter(),
+		Synchronous: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = shutdown(context.Background()) }()
+
+	ctx, span := tracing.Tracer().Start(context.Background(), "test")
+	defer span.End()
+
+	h := make(http.Header)
+	tracing.Inject(ctx, h)
+
+	assert.Contains(h.Get("traceparent"), span.SpanContext().TraceID().String())
+}
+
+func TestInstrumenter(t *testing.T) {
+	assert := assert.New(t)
+	exporter := tracing.NewInMemoryExporter()
+
+	shutdown, err := tracing.Setup(tracing.Options{
+		Exporter:    exporter,
+		Synchronous: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = shutdown(context.Background()) }()
+	defer instrument.Set(nil)
+
+	h := instrument.Handler("test-handler", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		instrument.AddAttribute(r.Context(), "user", "123")
+		instrument.StartSegment(r.Context(), "work").End()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	spans := exporter.GetSpans()
+	if !assert.Len(spans, 2) {
+		return
+	}
+
+	segment, txn := spans[0], spans[1]
+	assert.Equal("work", segment.Name)
+	assert.Equal("test-handler", txn.Name)
+	assert.Equal(txn.SpanContext.SpanID(), segment.Parent.SpanID())
+	assert.Contains(txn.Attributes, attribute.String("user", "123"))
+
+	// without a matched route, there is no http.route attribute
+	for _, attr := range txn.Attributes {
+		assert.NotEqual(semconv.HTTPRouteKey, attr.Key)
+	}
+}
@@ -6,6 +6,8 @@ package write
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/nickhstr/goweb/requestid"
 )
 
 // ErrorResponse provides a standard error response format.
@@ -13,14 +15,18 @@ type ErrorResponse struct {
 	Status     int    `json:"status"`
 	StatusText string `json:"statusText"`
 	Error      string `json:"error"`
+	RequestID  string `json:"requestID,omitempty"`
 }
 
 // Error writes an HTTP JSON error response.
+// If the response already carries a request ID header (see
+// middleware.RequestID), it is included in the response body.
 func Error(w http.ResponseWriter, err string, code int) {
 	errResponse := ErrorResponse{
 		code,
 		http.StatusText(code),
 		err,
+		w.Header().Get(requestid.Header),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
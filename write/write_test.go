@@ -7,20 +7,29 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/nickhstr/goweb/requestid"
 	"github.com/nickhstr/goweb/write"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestError(t *testing.T) {
 	tests := []struct {
-		name string
-		err  string
-		code int
+		name      string
+		err       string
+		code      int
+		requestID string
 	}{
 		{
 			"Error should write a JSON error reponse",
 			"Something has gone horribly wrong",
 			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"Error should include the response's request ID",
+			"Something has gone horribly wrong",
+			http.StatusInternalServerError,
+			"abc123",
 		},
 	}
 
@@ -28,12 +37,18 @@ func TestError(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			assert := assert.New(t)
 			respRec := httptest.NewRecorder()
+
+			if test.requestID != "" {
+				respRec.Header().Set(requestid.Header, test.requestID)
+			}
+
 			write.Error(respRec, test.err, test.code)
 
 			expectedBody, _ := json.Marshal(write.ErrorResponse{
 				test.code,
 				http.StatusText(test.code),
 				test.err,
+				test.requestID,
 			})
 			// Add newline, as write.Error uses json.Encoder, which adds a newline
 			expectedBody = append(expectedBody, '\n')